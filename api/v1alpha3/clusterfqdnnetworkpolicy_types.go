@@ -0,0 +1,75 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterFQDNNetworkPolicySpec defines the desired state of ClusterFQDNNetworkPolicy
+type ClusterFQDNNetworkPolicySpec struct {
+	// NamespaceSelector selects the namespaces the FQDNNetworkPolicy is
+	// created in. An empty selector selects all the namespaces.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	// The FQDNNetworkPolicy created in each selected namespace
+	FQDNNetworkPolicySpec `json:",inline"`
+}
+
+// ClusterFQDNNetworkPolicyStatus defines the observed state of ClusterFQDNNetworkPolicy
+type ClusterFQDNNetworkPolicyStatus struct {
+	// Namespaces lists the namespaces the FQDNNetworkPolicy was created in
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ObservedGeneration is the generation of the ClusterFQDNNetworkPolicy
+	// last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the current state of the ClusterFQDNNetworkPolicy
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Namespaces",type=string,JSONPath=`.status.namespaces`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterFQDNNetworkPolicy is the Schema for the clusterfqdnnetworkpolicies
+// API. It creates a FQDNNetworkPolicy of the same name in each namespace
+// matching its namespaceSelector.
+type ClusterFQDNNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterFQDNNetworkPolicySpec   `json:"spec,omitempty"`
+	Status ClusterFQDNNetworkPolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterFQDNNetworkPolicyList contains a list of ClusterFQDNNetworkPolicy
+type ClusterFQDNNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterFQDNNetworkPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterFQDNNetworkPolicy{}, &ClusterFQDNNetworkPolicyList{})
+}
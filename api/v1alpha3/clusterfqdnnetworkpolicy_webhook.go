@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var clusterfqdnnetworkpolicylog = logf.Log.WithName("clusterfqdnnetworkpolicy-resource")
+
+func (r *ClusterFQDNNetworkPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	fqdnSetReader = mgr.GetAPIReader()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-networking-gke-io-v1alpha3-clusterfqdnnetworkpolicy,mutating=true,failurePolicy=fail,sideEffects=None,groups=networking.gke.io,resources=clusterfqdnnetworkpolicies,verbs=create;update,versions=v1alpha3,name=mclusterfqdnnetworkpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &ClusterFQDNNetworkPolicy{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ClusterFQDNNetworkPolicy) Default() {
+	clusterfqdnnetworkpolicylog.Info("default", "name", r.Name)
+
+	// The FQDNNetworkPolicies created from the ClusterFQDNNetworkPolicy
+	// are defaulted the same way
+	policy := r.fqdnNetworkPolicy()
+	policy.Default()
+	r.Spec.FQDNNetworkPolicySpec = policy.Spec
+}
+
+//+kubebuilder:webhook:path=/validate-networking-gke-io-v1alpha3-clusterfqdnnetworkpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=networking.gke.io,resources=clusterfqdnnetworkpolicies,verbs=create;update,versions=v1alpha3,name=vclusterfqdnnetworkpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterFQDNNetworkPolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterFQDNNetworkPolicy) ValidateCreate() (admission.Warnings, error) {
+	clusterfqdnnetworkpolicylog.Info("validate create", "name", r.Name)
+	return nil, r.validate(nil)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterFQDNNetworkPolicy) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	clusterfqdnnetworkpolicylog.Info("validate update", "name", r.Name)
+	oldPolicy, _ := old.(*ClusterFQDNNetworkPolicy)
+	return nil, r.validate(oldPolicy)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterFQDNNetworkPolicy) ValidateDelete() (admission.Warnings, error) {
+	clusterfqdnnetworkpolicylog.Info("validate delete", "name", r.Name)
+	return nil, nil
+}
+
+// validate checks the namespace selector, and the rest of the spec like the
+// spec of a FQDNNetworkPolicy, updated from old if it isn't nil
+func (r *ClusterFQDNNetworkPolicy) validate(old *ClusterFQDNNetworkPolicy) error {
+	var allErrs field.ErrorList
+	if _, err := metav1.LabelSelectorAsSelector(&r.Spec.NamespaceSelector); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("namespaceSelector"),
+			r.Spec.NamespaceSelector, err.Error()))
+	}
+	policy := r.fqdnNetworkPolicy()
+	allErrs = append(allErrs, policy.ValidatePorts()...)
+	allErrs = append(allErrs, policy.ValidateFQDNs()...)
+	allErrs = append(allErrs, policy.ValidatePeers()...)
+	// The FQDNSets are looked up in each selected namespace, only the
+	// ClusterFQDNSets can be checked
+	var oldPolicy *FQDNNetworkPolicy
+	if old != nil {
+		oldPolicy = old.fqdnNetworkPolicy()
+	}
+	allErrs = append(allErrs, policy.ValidateFQDNSetRefs(context.TODO(), fqdnSetReader, oldPolicy)...)
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "networking.gke.io", Kind: "ClusterFQDNNetworkPolicy"},
+		r.Name, allErrs)
+}
+
+// fqdnNetworkPolicy returns a FQDNNetworkPolicy with the spec of the
+// ClusterFQDNNetworkPolicy, sharing its rules
+func (r *ClusterFQDNNetworkPolicy) fqdnNetworkPolicy() *FQDNNetworkPolicy {
+	return &FQDNNetworkPolicy{ObjectMeta: r.ObjectMeta, Spec: r.Spec.FQDNNetworkPolicySpec}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestClusterValidateCreate(t *testing.T) {
+	r := ClusterFQDNNetworkPolicy{}
+	if _, err := r.GetValidResource().ValidateCreate(); err != nil {
+		t.Errorf("Valid resource marked as invalid during creation: %v", err)
+	}
+
+	if _, err := r.GetInvalidResource().ValidateCreate(); err == nil {
+		t.Error("Resource with an invalid namespace selector marked as valid during creation")
+	}
+
+	r = ClusterFQDNNetworkPolicy{}
+	r.GetValidResource().Spec.Egress[0].To[0].FQDNs = []string{"api.*.example.com"}
+	if _, err := r.ValidateCreate(); err == nil {
+		t.Error("Resource with an invalid FQDN marked as valid during creation")
+	}
+}
+
+func TestClusterValidateUpdate(t *testing.T) {
+	r := ClusterFQDNNetworkPolicy{}
+	ro := ClusterFQDNNetworkPolicy{}
+	ro.GetValidResource()
+
+	if _, err := r.GetValidResource().ValidateUpdate(&ro); err != nil {
+		t.Errorf("Valid resource marked as invalid during update: %v", err)
+	}
+
+	if _, err := r.GetInvalidResource().ValidateUpdate(&ro); err == nil {
+		t.Error("Resource with an invalid namespace selector marked as valid during update")
+	}
+}
+
+func TestClusterDefault(t *testing.T) {
+	r := ClusterFQDNNetworkPolicy{}
+	r.GetValidResource()
+	protocol := v1.Protocol("")
+	r.Spec.Egress[0].Ports[0].Protocol = &protocol
+	r.Default()
+	if p := r.Spec.Egress[0].Ports[0].Protocol; p == nil || *p != v1.ProtocolTCP {
+		t.Errorf("Expected the protocol to default to TCP, got %v", p)
+	}
+}
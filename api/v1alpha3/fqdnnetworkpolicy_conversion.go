@@ -0,0 +1,32 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+// The annotations of the FQDNNetworkPolicies that are fields of the spec in
+// later versions of the API
+const (
+	// AAAALookupsAnnotation is set to skip to leave the IPv6 addresses of the
+	// FQDNs out of the NetworkPolicy
+	AAAALookupsAnnotation = "fqdnnetworkpolicies.networking.gke.io/aaaa-lookups"
+	// DeletePolicyAnnotation is set to abandon to keep the NetworkPolicy when
+	// the FQDNNetworkPolicy is deleted
+	DeletePolicyAnnotation = "fqdnnetworkpolicies.networking.gke.io/delete-policy"
+)
+
+// Hub marks v1alpha3, the storage version, as the version the other
+// versions of FQDNNetworkPolicy are converted to and from
+func (*FQDNNetworkPolicy) Hub() {}
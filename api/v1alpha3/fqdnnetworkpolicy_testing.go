@@ -27,6 +27,19 @@ import (
 
 // LoadResource unmarshalls a given yaml file in a FQDNNetworkPolicy
 func (r *FQDNNetworkPolicy) LoadResource(path string) *FQDNNetworkPolicy {
+	loadYAML(path, r)
+	return r
+}
+
+// LoadResource unmarshalls a given yaml file in a ClusterFQDNNetworkPolicy
+func (r *ClusterFQDNNetworkPolicy) LoadResource(path string) *ClusterFQDNNetworkPolicy {
+	loadYAML(path, r)
+	return r
+}
+
+// loadYAML unmarshalls the yaml file at path, relative to the root of the
+// project, in obj
+func loadYAML(path string, obj interface{}) {
 	// Path to this file
 	_, filename, _, _ := runtime.Caller(0)
 	pSlice := strings.Split(filename, "/")
@@ -35,12 +48,10 @@ func (r *FQDNNetworkPolicy) LoadResource(path string) *FQDNNetworkPolicy {
 	if err != nil {
 		log.Printf("yamlFile.Get err   #%v ", err)
 	}
-	err = yaml.Unmarshal(yamlFile, r)
+	err = yaml.Unmarshal(yamlFile, obj)
 	if err != nil {
 		log.Fatalf("Unmarshal: %v", err)
 	}
-
-	return r
 }
 
 // GetValidResource returns loads a valid FQDNNetworkPolicy for testing
@@ -69,6 +80,27 @@ func (r *FQDNNetworkPolicy) GetValidAaaaLookupsSkippedResource() *FQDNNetworkPol
 	return r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_valid_aaaalookupsskipped.yaml")
 }
 
+func (r *FQDNNetworkPolicy) GetValidWildcardResource() *FQDNNetworkPolicy {
+	return r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_valid_wildcard.yaml")
+}
+
+func (r *FQDNNetworkPolicy) GetValidMixedPeersResource() *FQDNNetworkPolicy {
+	return r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_valid_mixedpeers.yaml")
+}
+
+func (r *FQDNNetworkPolicy) GetValidFQDNSetRefResource() *FQDNNetworkPolicy {
+	return r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_valid_fqdnsetref.yaml")
+}
+
 func (r *FQDNNetworkPolicy) GetInvalidResource() *FQDNNetworkPolicy {
 	return r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_invalid.yaml")
 }
+
+// GetValidResource loads a valid ClusterFQDNNetworkPolicy for testing
+func (r *ClusterFQDNNetworkPolicy) GetValidResource() *ClusterFQDNNetworkPolicy {
+	return r.LoadResource("./config/samples/networking_v1alpha3_clusterfqdnnetworkpolicy_valid.yaml")
+}
+
+func (r *ClusterFQDNNetworkPolicy) GetInvalidResource() *ClusterFQDNNetworkPolicy {
+	return r.LoadResource("./config/samples/networking_v1alpha3_clusterfqdnnetworkpolicy_invalid.yaml")
+}
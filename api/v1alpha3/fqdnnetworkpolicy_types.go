@@ -36,6 +36,20 @@ const (
 	DestroyingState State = "Destroying"
 )
 
+const (
+	// ReadyCondition is True when the NetworkPolicy is up to date with the
+	// FQDNNetworkPolicy
+	ReadyCondition = "Ready"
+	// ResolvedCondition is True when all the FQDNs could be resolved
+	ResolvedCondition = "Resolved"
+	// NetworkPolicySyncedCondition is True when the NetworkPolicy has been
+	// created or updated from the last resolution of the FQDNs
+	NetworkPolicySyncedCondition = "NetworkPolicySynced"
+	// DegradedCondition is True when the NetworkPolicy is synced but some
+	// of the FQDNs couldn't be resolved
+	DegradedCondition = "Degraded"
+)
+
 // FQDNNetworkPolicySpec defines the desired state of FQDNNetworkPolicy
 type FQDNNetworkPolicySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -56,10 +70,69 @@ type FQDNNetworkPolicyStatus struct {
 	Reason       string       `json:"reason,omitempty"`
 	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
 	NextSyncTime *metav1.Time `json:"nextSyncTime,omitempty"`
+	// Attempts is the number of consecutive failed attempts to sync the
+	// NetworkPolicy. The next attempt happens at NextSyncTime.
+	Attempts int32 `json:"attempts,omitempty"`
+	// FQDNs lists how the FQDNs of the FQDNNetworkPolicy were resolved
+	FQDNs []FQDNStatus `json:"fqdns,omitempty"`
+	// OmittedFQDNs is the number of FQDNs left out of FQDNs to bound the
+	// size of the status
+	OmittedFQDNs int32 `json:"omittedFQDNs,omitempty"`
+	// WildcardHostnames lists hostnames the wildcard FQDNs of the
+	// FQDNNetworkPolicy are expanded to, along with the ones observed in the
+	// DNS query log. The controller doesn't write it: it's set through the
+	// status subresource by whoever knows the hostnames.
+	// +optional
+	WildcardHostnames []string `json:"wildcardHostnames,omitempty"`
+	// ObservedGeneration is the generation of the FQDNNetworkPolicy
+	// last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the current state of the FQDNNetworkPolicy
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// FQDNStatus describes how a FQDN of the FQDNNetworkPolicy was resolved
+type FQDNStatus struct {
+	// FQDN is the name as written in the FQDNNetworkPolicy
+	FQDN string `json:"fqdn"`
+	// Hostnames lists the hostnames resolved for a wildcard FQDN
+	Hostnames []string `json:"hostnames,omitempty"`
+	// CNAMEChain lists the canonical names followed to resolve the FQDN, in order
+	CNAMEChain []string `json:"cnameChain,omitempty"`
+	// Addresses lists the addresses of the FQDN in the NetworkPolicy,
+	// including the ones still retained after they stopped being resolved
+	Addresses []AddressStatus `json:"addresses,omitempty"`
+	// OmittedAddresses is the number of addresses left out of Addresses
+	// to bound the size of the status
+	OmittedAddresses int32 `json:"omittedAddresses,omitempty"`
+	// TTL is the lowest TTL, in seconds, of the records of the FQDN
+	TTL int32 `json:"ttl,omitempty"`
+	// Nameserver is the nameserver that answered the last query
+	Nameserver string `json:"nameserver,omitempty"`
+	// LastResolved is the last time the FQDN was resolved successfully
+	LastResolved *metav1.Time `json:"lastResolved,omitempty"`
+	// LastError is the error of the last resolution of the FQDN, if it failed,
+	// or its outcome, such as NXDOMAIN, if it found no address
+	LastError string `json:"lastError,omitempty"`
+}
+
+// AddressStatus is an address of a FQDN in the NetworkPolicy
+type AddressStatus struct {
+	// IP is the IPv4 or IPv6 address
+	IP string `json:"ip"`
+	// LastSeen is the last time the address was resolved for the FQDN
+	LastSeen metav1.Time `json:"lastSeen"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // FQDNNetworkPolicy is the Schema for the fqdnnetworkpolicies API
 type FQDNNetworkPolicy struct {
@@ -97,10 +170,29 @@ type FQDNNetworkPolicyIngressRule struct {
 	From  []FQDNNetworkPolicyPeer        `json:"from"`
 }
 
-// FQDNNetworkPolicyPeer represents a FQDN that the
-// FQDNNetworkPolicy allows connections to.
+// FQDNNetworkPolicyPeer represents the FQDNs, or the pods or CIDR blocks,
+// that the FQDNNetworkPolicy allows connections to. The FQDNs and FQDN set
+// can't be combined with the other fields in a single peer.
 type FQDNNetworkPolicyPeer struct {
-	FQDNs []string `json:"fqdns"`
+	// FQDNs are the hostnames to allow. The leftmost label can be a *
+	// wildcard matching a single label, such as *.example.com: the
+	// hostnames matching it are taken from the wildcardHostnames status
+	// field of the FQDNNetworkPolicy, and from the DNS query log if the
+	// controller is configured to read one.
+	// +optional
+	FQDNs []string `json:"fqdns,omitempty"`
+	// FQDNSetRef references a FQDNSet or ClusterFQDNSet whose FQDNs are
+	// allowed along with the FQDNs of the peer
+	// +optional
+	FQDNSetRef *FQDNSetReference `json:"fqdnSetRef,omitempty"`
+	// PodSelector, NamespaceSelector and IPBlock are copied as is to the
+	// NetworkPolicy, see the NetworkPolicyPeer of NetworkPolicies.
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// +optional
+	IPBlock *networking.IPBlock `json:"ipBlock,omitempty"`
 }
 
 func init() {
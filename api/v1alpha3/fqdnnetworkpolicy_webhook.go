@@ -17,13 +17,20 @@ limitations under the License.
 package v1alpha3
 
 import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
 	"golang.org/x/net/idna"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -32,7 +39,13 @@ import (
 // log is for logging in this package.
 var fqdnnetworkpolicylog = logf.Log.WithName("fqdnnetworkpolicy-resource")
 
+// fqdnSetReader reads the FQDNSets and ClusterFQDNSets referenced by the
+// FQDNNetworkPolicies, to reject the references to missing sets. It's set
+// along with the webhooks.
+var fqdnSetReader client.Reader
+
 func (r *FQDNNetworkPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	fqdnSetReader = mgr.GetAPIReader()
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -92,6 +105,8 @@ func (r *FQDNNetworkPolicy) ValidateCreate() (admission.Warnings, error) {
 	var allErrs field.ErrorList
 	allErrs = append(allErrs, r.ValidatePorts()...)
 	allErrs = append(allErrs, r.ValidateFQDNs()...)
+	allErrs = append(allErrs, r.ValidatePeers()...)
+	allErrs = append(allErrs, r.ValidateFQDNSetRefs(context.TODO(), fqdnSetReader, nil)...)
 
 	if len(allErrs) == 0 {
 		return nil, nil
@@ -109,6 +124,10 @@ func (r *FQDNNetworkPolicy) ValidateUpdate(old runtime.Object) (admission.Warnin
 	var allErrs field.ErrorList
 	allErrs = append(allErrs, r.ValidatePorts()...)
 	allErrs = append(allErrs, r.ValidateFQDNs()...)
+	allErrs = append(allErrs, r.ValidatePeers()...)
+	// The sets already referenced may have been deleted since
+	oldPolicy, _ := old.(*FQDNNetworkPolicy)
+	allErrs = append(allErrs, r.ValidateFQDNSetRefs(context.TODO(), fqdnSetReader, oldPolicy)...)
 
 	if len(allErrs) == 0 {
 		return nil, nil
@@ -184,40 +203,31 @@ func (r *FQDNNetworkPolicy) ValidatePorts() field.ErrorList {
 	return allErrs
 }
 
-// ValidateFQDNs checks that the FQDNs provided don't contain any wildcards
+// ValidateFQDNs checks that the FQDNs provided are valid hostnames, with
+// wildcards only as their leftmost label
 func (r *FQDNNetworkPolicy) ValidateFQDNs() field.ErrorList {
 	var allErrs field.ErrorList
 
 	for ie, rule := range r.Spec.Egress {
-		if rule.To != nil {
-			for ito, to := range rule.To {
-				for ifqdn, fqdn := range to.FQDNs {
-					var p *idna.Profile
-					p = idna.New(idna.ValidateForRegistration())
-					_, err := p.ToASCII(fqdn)
-					if err != nil {
-						allErrs = append(allErrs, field.Invalid(
-							field.NewPath("spec").Child("egress").Index(ie).
-								Child("to").Index(ito).Child("fqdns").Index(ifqdn),
-							fqdn, err.Error()))
-					}
+		for ito, to := range rule.To {
+			for ifqdn, fqdn := range to.FQDNs {
+				if err := validateFQDN(fqdn); err != nil {
+					allErrs = append(allErrs, field.Invalid(
+						field.NewPath("spec").Child("egress").Index(ie).
+							Child("to").Index(ito).Child("fqdns").Index(ifqdn),
+						fqdn, err.Error()))
 				}
 			}
 		}
 	}
 	for ii, rule := range r.Spec.Ingress {
-		if rule.From != nil {
-			for ifrom, from := range rule.From {
-				for ifqdn, fqdn := range from.FQDNs {
-					var p *idna.Profile
-					p = idna.New(idna.ValidateForRegistration())
-					_, err := p.ToASCII(fqdn)
-					if err != nil {
-						allErrs = append(allErrs, field.Invalid(
-							field.NewPath("spec").Child("egress").Index(ii).
-								Child("to").Index(ifrom).Child("fqdns").Index(ifqdn),
-							fqdn, err.Error()))
-					}
+		for ifrom, from := range rule.From {
+			for ifqdn, fqdn := range from.FQDNs {
+				if err := validateFQDN(fqdn); err != nil {
+					allErrs = append(allErrs, field.Invalid(
+						field.NewPath("spec").Child("ingress").Index(ii).
+							Child("from").Index(ifrom).Child("fqdns").Index(ifqdn),
+						fqdn, err.Error()))
 				}
 			}
 		}
@@ -227,3 +237,202 @@ func (r *FQDNNetworkPolicy) ValidateFQDNs() field.ErrorList {
 	}
 	return allErrs
 }
+
+// validateFQDN checks that fqdn is a valid hostname, or a wildcard such as
+// *.example.com
+func validateFQDN(fqdn string) error {
+	hostname := fqdn
+	if strings.HasPrefix(fqdn, "*.") {
+		hostname = fqdn[2:]
+	}
+	if strings.Contains(hostname, "*") {
+		return errors.New("wildcards are only allowed as the leftmost label, such as *.example.com")
+	}
+	_, err := idna.New(idna.ValidateForRegistration()).ToASCII(hostname)
+	return err
+}
+
+// ValidatePeers checks that each peer has either FQDNs, or pod selectors or a
+// CIDR block, which are checked like the peers of NetworkPolicies
+func (r *FQDNNetworkPolicy) ValidatePeers() field.ErrorList {
+	var allErrs field.ErrorList
+
+	for ie, rule := range r.Spec.Egress {
+		for ito, to := range rule.To {
+			allErrs = append(allErrs, validatePeer(to,
+				field.NewPath("spec").Child("egress").Index(ie).Child("to").Index(ito))...)
+		}
+	}
+	for ii, rule := range r.Spec.Ingress {
+		for ifrom, from := range rule.From {
+			allErrs = append(allErrs, validatePeer(from,
+				field.NewPath("spec").Child("ingress").Index(ii).Child("from").Index(ifrom))...)
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return allErrs
+}
+
+// validatePeer checks a single peer, at path
+func validatePeer(peer FQDNNetworkPolicyPeer, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	selectors := peer.PodSelector != nil || peer.NamespaceSelector != nil
+	switch {
+	case len(peer.FQDNs) == 0 && peer.FQDNSetRef == nil && !selectors && peer.IPBlock == nil:
+		allErrs = append(allErrs, field.Required(path,
+			"must specify fqdns, fqdnSetRef, podSelector, namespaceSelector or ipBlock"))
+	case len(peer.FQDNs) > 0 && (selectors || peer.IPBlock != nil):
+		allErrs = append(allErrs, field.Forbidden(path.Child("fqdns"),
+			"may not be specified with podSelector, namespaceSelector or ipBlock"))
+	case peer.FQDNSetRef != nil && (selectors || peer.IPBlock != nil):
+		allErrs = append(allErrs, field.Forbidden(path.Child("fqdnSetRef"),
+			"may not be specified with podSelector, namespaceSelector or ipBlock"))
+	case selectors && peer.IPBlock != nil:
+		allErrs = append(allErrs, field.Forbidden(path.Child("ipBlock"),
+			"may not be specified with podSelector or namespaceSelector"))
+	}
+	if ref := peer.FQDNSetRef; ref != nil {
+		if ref.Kind != "" && ref.Kind != FQDNSetKind && ref.Kind != ClusterFQDNSetKind {
+			allErrs = append(allErrs, field.NotSupported(path.Child("fqdnSetRef").Child("kind"),
+				ref.Kind, []string{FQDNSetKind, ClusterFQDNSetKind}))
+		}
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("fqdnSetRef").Child("name"), ""))
+		}
+	}
+	for _, s := range []struct {
+		selector *metav1.LabelSelector
+		name     string
+	}{{peer.PodSelector, "podSelector"}, {peer.NamespaceSelector, "namespaceSelector"}} {
+		if s.selector == nil {
+			continue
+		}
+		if _, err := metav1.LabelSelectorAsSelector(s.selector); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child(s.name), s.selector, err.Error()))
+		}
+	}
+	if peer.IPBlock != nil {
+		_, cidr, err := net.ParseCIDR(peer.IPBlock.CIDR)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("ipBlock").Child("cidr"),
+				peer.IPBlock.CIDR, err.Error()))
+			return allErrs
+		}
+		cidrOnes, _ := cidr.Mask.Size()
+		for i, except := range peer.IPBlock.Except {
+			_, exceptCIDR, err := net.ParseCIDR(except)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("ipBlock").Child("except").Index(i),
+					except, err.Error()))
+				continue
+			}
+			exceptOnes, _ := exceptCIDR.Mask.Size()
+			if !cidr.Contains(exceptCIDR.IP) || exceptOnes <= cidrOnes {
+				allErrs = append(allErrs, field.Invalid(path.Child("ipBlock").Child("except").Index(i),
+					except, "must be a strict subset of cidr"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateFQDNSetRefs checks that the FQDNSets and ClusterFQDNSets referenced
+// by the peers exist, reading them with reader if it isn't nil. On updates,
+// only the references that aren't in old are checked, and none once the
+// FQDNNetworkPolicy is being deleted, so that it can still be deleted after
+// the sets it references.
+func (r *FQDNNetworkPolicy) ValidateFQDNSetRefs(ctx context.Context, reader client.Reader,
+	old *FQDNNetworkPolicy) field.ErrorList {
+	if reader == nil || r.DeletionTimestamp != nil {
+		return nil
+	}
+	existing := map[FQDNSetReference]bool{}
+	if old != nil {
+		existing = old.fqdnSetRefs()
+	}
+	var allErrs field.ErrorList
+
+	for ie, rule := range r.Spec.Egress {
+		for ito, to := range rule.To {
+			if to.FQDNSetRef != nil && existing[normalizeFQDNSetRef(*to.FQDNSetRef)] {
+				continue
+			}
+			allErrs = append(allErrs, validateFQDNSetRef(ctx, reader, r.Namespace, to.FQDNSetRef,
+				field.NewPath("spec").Child("egress").Index(ie).Child("to").Index(ito).Child("fqdnSetRef"))...)
+		}
+	}
+	for ii, rule := range r.Spec.Ingress {
+		for ifrom, from := range rule.From {
+			if from.FQDNSetRef != nil && existing[normalizeFQDNSetRef(*from.FQDNSetRef)] {
+				continue
+			}
+			allErrs = append(allErrs, validateFQDNSetRef(ctx, reader, r.Namespace, from.FQDNSetRef,
+				field.NewPath("spec").Child("ingress").Index(ii).Child("from").Index(ifrom).Child("fqdnSetRef"))...)
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return allErrs
+}
+
+// fqdnSetRefs returns the normalized references to sets of the peers
+func (r *FQDNNetworkPolicy) fqdnSetRefs() map[FQDNSetReference]bool {
+	refs := map[FQDNSetReference]bool{}
+	for _, rule := range r.Spec.Egress {
+		for _, to := range rule.To {
+			if to.FQDNSetRef != nil {
+				refs[normalizeFQDNSetRef(*to.FQDNSetRef)] = true
+			}
+		}
+	}
+	for _, rule := range r.Spec.Ingress {
+		for _, from := range rule.From {
+			if from.FQDNSetRef != nil {
+				refs[normalizeFQDNSetRef(*from.FQDNSetRef)] = true
+			}
+		}
+	}
+	return refs
+}
+
+// normalizeFQDNSetRef returns ref with its default kind
+func normalizeFQDNSetRef(ref FQDNSetReference) FQDNSetReference {
+	if ref.Kind == "" {
+		ref.Kind = FQDNSetKind
+	}
+	return ref
+}
+
+// validateFQDNSetRef checks that the set referenced by ref, at path, exists.
+// Without a namespace, only the references to ClusterFQDNSets are checked.
+func validateFQDNSetRef(ctx context.Context, reader client.Reader, namespace string,
+	ref *FQDNSetReference, path *field.Path) field.ErrorList {
+	if ref == nil || ref.Name == "" {
+		return nil
+	}
+	var set client.Object
+	key := client.ObjectKey{Name: ref.Name}
+	switch ref.Kind {
+	case "", FQDNSetKind:
+		if namespace == "" {
+			return nil
+		}
+		set = &FQDNSet{}
+		key.Namespace = namespace
+	case ClusterFQDNSetKind:
+		set = &ClusterFQDNSet{}
+	default:
+		// rejected by validatePeer
+		return nil
+	}
+	if err := reader.Get(ctx, key, set); err != nil {
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(path.Child("name"), ref.Name)}
+		}
+		return field.ErrorList{field.InternalError(path, err)}
+	}
+	return nil
+}
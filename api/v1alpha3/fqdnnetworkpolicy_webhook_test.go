@@ -17,7 +17,14 @@ limitations under the License.
 package v1alpha3
 
 import (
+	"context"
 	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestValidateCreate(t *testing.T) {
@@ -138,9 +145,13 @@ func TestValidateFQDNs(t *testing.T) {
 		t.Error("Valid resource with no protocol marked as having invalid ports")
 	}
 
+	if r.GetValidWildcardResource().ValidateFQDNs() != nil {
+		t.Error("Valid resource with a wildcard marked as having invalid FQDNs")
+	}
+
 	r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_invalid_wildcard.yaml")
 	if r.ValidateFQDNs() == nil {
-		t.Error("Resource with wildcard marked as valid")
+		t.Error("Resource with wildcard not in the leftmost label marked as valid")
 	}
 	r.LoadResource("./config/samples/networking_v1alpha3_fqdnnetworkpolicy_invalid_fqdntoolong.yaml")
 	if r.ValidateFQDNs() == nil {
@@ -151,3 +162,136 @@ func TestValidateFQDNs(t *testing.T) {
 		t.Error("Resource with invalid FQDN (label too long) marked as valid")
 	}
 }
+
+func TestValidatePeers(t *testing.T) {
+	r := FQDNNetworkPolicy{}
+
+	if r.GetValidResource().ValidatePeers() != nil {
+		t.Error("Valid resource marked as having invalid peers")
+	}
+	if r.GetValidMixedPeersResource().ValidatePeers() != nil {
+		t.Error("Valid resource with mixed peers marked as having invalid peers")
+	}
+	if (&FQDNNetworkPolicy{}).GetValidFQDNSetRefResource().ValidatePeers() != nil {
+		t.Error("Valid resource with FQDN set references marked as having invalid peers")
+	}
+
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+	for name, peer := range map[string]FQDNNetworkPolicyPeer{
+		"empty peer":            {},
+		"FQDNs with a selector": {FQDNs: []string{"github.com"}, PodSelector: selector},
+		"fqdnSetRef with ipBlock": {FQDNSetRef: &FQDNSetReference{Name: "saas"},
+			IPBlock: &networking.IPBlock{CIDR: "10.0.0.0/8"}},
+		"fqdnSetRef without name":      {FQDNSetRef: &FQDNSetReference{Kind: FQDNSetKind}},
+		"fqdnSetRef with unknown kind": {FQDNSetRef: &FQDNSetReference{Kind: "HostSet", Name: "saas"}},
+		"ipBlock with selector":        {IPBlock: &networking.IPBlock{CIDR: "10.0.0.0/8"}, NamespaceSelector: selector},
+		"invalid CIDR":                 {IPBlock: &networking.IPBlock{CIDR: "10.0.0.0/33"}},
+		"except outside of CIDR":       {IPBlock: &networking.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"192.168.0.0/16"}}},
+		"invalid selector": {PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "app", Operator: "Like"}}}},
+	} {
+		r := r.GetValidResource()
+		r.Spec.Egress[0].To = []FQDNNetworkPolicyPeer{peer}
+		if r.ValidatePeers() == nil {
+			t.Errorf("Resource with %s marked as valid", name)
+		}
+	}
+}
+
+// setReader is a client.Reader holding the FQDNSets and ClusterFQDNSets of
+// names, by namespace/name
+type setReader struct {
+	client.Reader
+	names map[string]bool
+}
+
+func (s setReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if !s.names[key.Namespace+"/"+key.Name] {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	return nil
+}
+
+func TestValidateFQDNSetRefs(t *testing.T) {
+	r := FQDNNetworkPolicy{}
+	r.GetValidFQDNSetRefResource()
+	r.Namespace = "default"
+
+	if r.ValidateFQDNSetRefs(context.Background(), nil, nil) != nil {
+		t.Error("References checked without a reader")
+	}
+	reader := setReader{names: map[string]bool{"default/saas": true, "/saas": true}}
+	if errs := r.ValidateFQDNSetRefs(context.Background(), reader, nil); errs != nil {
+		t.Errorf("Existing sets marked as missing: %v", errs)
+	}
+	for name, names := range map[string]map[string]bool{
+		"missing FQDNSet":              {"/saas": true},
+		"FQDNSet in another namespace": {"other/saas": true, "/saas": true},
+		"missing ClusterFQDNSet":       {"default/saas": true},
+	} {
+		if r.ValidateFQDNSetRefs(context.Background(), setReader{names: names}, nil) == nil {
+			t.Errorf("Resource with a %s marked as valid", name)
+		}
+	}
+
+	// Without a namespace, as for ClusterFQDNNetworkPolicies, only the
+	// references to ClusterFQDNSets are checked
+	r.Namespace = ""
+	if errs := r.ValidateFQDNSetRefs(context.Background(), setReader{names: map[string]bool{"/saas": true}}, nil); errs != nil {
+		t.Errorf("Reference to a FQDNSet checked without a namespace: %v", errs)
+	}
+
+	// On updates, only the references that changed are checked
+	r.Namespace = "default"
+	old := r.DeepCopy()
+	missing := setReader{names: map[string]bool{}}
+	if errs := r.ValidateFQDNSetRefs(context.Background(), missing, old); errs != nil {
+		t.Errorf("Unchanged references checked on update: %v", errs)
+	}
+	r.Spec.Egress[0].To[0].FQDNSetRef = &FQDNSetReference{Kind: FQDNSetKind, Name: "saas"}
+	if errs := r.ValidateFQDNSetRefs(context.Background(), missing, old); errs != nil {
+		t.Errorf("Reference with the default kind checked on update: %v", errs)
+	}
+	r.Spec.Egress[0].To[0].FQDNSetRef.Name = "other"
+	if r.ValidateFQDNSetRefs(context.Background(), missing, old) == nil {
+		t.Error("Changed reference to a missing FQDNSet marked as valid")
+	}
+}
+
+func TestValidateUpdateDeletedFQDNSet(t *testing.T) {
+	defer func(reader client.Reader) { fqdnSetReader = reader }(fqdnSetReader)
+	fqdnSetReader = setReader{names: map[string]bool{}}
+
+	// The FQDNNetworkPolicy is being deleted after the sets it references,
+	// removing its finalizer must still be allowed
+	old := FQDNNetworkPolicy{}
+	old.GetValidFQDNSetRefResource()
+	old.Namespace = "default"
+	old.Finalizers = []string{"finalizer.fqdnnetworkpolicies.networking.gke.io"}
+	now := metav1.Now()
+	old.DeletionTimestamp = &now
+	r := old.DeepCopy()
+	r.Finalizers = nil
+	if _, err := r.ValidateUpdate(&old); err != nil {
+		t.Errorf("Removing the finalizer of a resource referencing deleted sets rejected: %v", err)
+	}
+
+	// It can't be updated to reference a missing set while it isn't
+	old.DeletionTimestamp = nil
+	r = old.DeepCopy()
+	r.Spec.Egress[0].To[0].FQDNSetRef.Name = "other"
+	if _, err := r.ValidateUpdate(&old); err == nil {
+		t.Error("Resource updated to reference a missing FQDNSet marked as valid")
+	}
+}
+
+func TestValidateFQDNSet(t *testing.T) {
+	set := FQDNSet{Spec: FQDNSetSpec{FQDNs: []string{"github.com", "*.example.com"}}}
+	if _, err := set.ValidateCreate(); err != nil {
+		t.Errorf("Valid FQDNSet marked as invalid: %v", err)
+	}
+	clusterSet := ClusterFQDNSet{Spec: FQDNSetSpec{FQDNs: []string{"github.com", "api.*.example.com"}}}
+	if _, err := clusterSet.ValidateUpdate(&clusterSet); err == nil {
+		t.Error("ClusterFQDNSet with an invalid FQDN marked as valid")
+	}
+}
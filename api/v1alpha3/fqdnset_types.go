@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The kinds of FQDN sets a FQDNNetworkPolicyPeer can reference
+const (
+	// FQDNSetKind is a FQDNSet, in the namespace of the FQDNNetworkPolicy
+	FQDNSetKind = "FQDNSet"
+	// ClusterFQDNSetKind is a ClusterFQDNSet
+	ClusterFQDNSetKind = "ClusterFQDNSet"
+)
+
+// FQDNSetSpec defines the FQDNs of a FQDNSet or ClusterFQDNSet
+type FQDNSetSpec struct {
+	// FQDNs are the hostnames of the set, like the fqdns of a
+	// FQDNNetworkPolicyPeer
+	// +kubebuilder:validation:MinItems=1
+	FQDNs []string `json:"fqdns"`
+}
+
+// FQDNSetReference references the FQDNSet or ClusterFQDNSet whose FQDNs a
+// FQDNNetworkPolicyPeer allows
+type FQDNSetReference struct {
+	// Kind is FQDNSet, for a FQDNSet in the namespace of the
+	// FQDNNetworkPolicy, or ClusterFQDNSet. Defaults to FQDNSet.
+	// +kubebuilder:validation:Enum=FQDNSet;ClusterFQDNSet
+	// +kubebuilder:default=FQDNSet
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Name is the name of the set
+	Name string `json:"name"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// FQDNSet is a named list of FQDNs that the FQDNNetworkPolicies of its
+// namespace can reference
+type FQDNSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec FQDNSetSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// FQDNSetList contains a list of FQDNSet
+type FQDNSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FQDNSet `json:"items"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterFQDNSet is a named list of FQDNs that all the FQDNNetworkPolicies
+// can reference
+type ClusterFQDNSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec FQDNSetSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterFQDNSetList contains a list of ClusterFQDNSet
+type ClusterFQDNSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterFQDNSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FQDNSet{}, &FQDNSetList{}, &ClusterFQDNSet{}, &ClusterFQDNSetList{})
+}
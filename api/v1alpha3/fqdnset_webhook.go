@@ -0,0 +1,103 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var fqdnsetlog = logf.Log.WithName("fqdnset-resource")
+
+func (r *FQDNSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+func (r *ClusterFQDNSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-networking-gke-io-v1alpha3-fqdnset,mutating=false,failurePolicy=fail,sideEffects=None,groups=networking.gke.io,resources=fqdnsets,verbs=create;update,versions=v1alpha3,name=vfqdnset.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &FQDNSet{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *FQDNSet) ValidateCreate() (admission.Warnings, error) {
+	fqdnsetlog.Info("validate create", "name", r.Name)
+	return nil, r.Spec.validate(FQDNSetKind, r.Name)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *FQDNSet) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	fqdnsetlog.Info("validate update", "name", r.Name)
+	return nil, r.Spec.validate(FQDNSetKind, r.Name)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *FQDNSet) ValidateDelete() (admission.Warnings, error) {
+	fqdnsetlog.Info("validate delete", "name", r.Name)
+	return nil, nil
+}
+
+//+kubebuilder:webhook:path=/validate-networking-gke-io-v1alpha3-clusterfqdnset,mutating=false,failurePolicy=fail,sideEffects=None,groups=networking.gke.io,resources=clusterfqdnsets,verbs=create;update,versions=v1alpha3,name=vclusterfqdnset.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterFQDNSet{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterFQDNSet) ValidateCreate() (admission.Warnings, error) {
+	fqdnsetlog.Info("validate create", "name", r.Name)
+	return nil, r.Spec.validate(ClusterFQDNSetKind, r.Name)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterFQDNSet) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	fqdnsetlog.Info("validate update", "name", r.Name)
+	return nil, r.Spec.validate(ClusterFQDNSetKind, r.Name)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterFQDNSet) ValidateDelete() (admission.Warnings, error) {
+	fqdnsetlog.Info("validate delete", "name", r.Name)
+	return nil, nil
+}
+
+// validate checks that the FQDNs of the set are valid hostnames, or wildcards
+// as in the FQDNNetworkPolicies
+func (s *FQDNSetSpec) validate(kind string, name string) error {
+	var allErrs field.ErrorList
+	for i, fqdn := range s.FQDNs {
+		if err := validateFQDN(fqdn); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("fqdns").Index(i),
+				fqdn, err.Error()))
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: "networking.gke.io", Kind: kind}, name, allErrs)
+}
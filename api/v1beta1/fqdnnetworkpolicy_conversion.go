@@ -0,0 +1,226 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+// The v1alpha3 values of the annotations promoted to the spec
+const (
+	skipAAAALookupsAnnotation      = "skip"
+	abandonNetworkPolicyAnnotation = "abandon"
+)
+
+var _ conversion.Convertible = &FQDNNetworkPolicy{}
+
+// ConvertTo converts this FQDNNetworkPolicy to the v1alpha3 hub, where
+// AAAALookups and DeletePolicy are annotations
+func (src *FQDNNetworkPolicy) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1alpha3.FQDNNetworkPolicy)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", dstRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Annotations = setAnnotation(dst.Annotations, v1alpha3.AAAALookupsAnnotation,
+		skipAAAALookupsAnnotation, src.Spec.AAAALookups == SkipAAAALookups)
+	dst.Annotations = setAnnotation(dst.Annotations, v1alpha3.DeletePolicyAnnotation,
+		abandonNetworkPolicyAnnotation, src.Spec.DeletePolicy == AbandonNetworkPolicy)
+
+	dst.Spec.PodSelector = *src.Spec.PodSelector.DeepCopy()
+	dst.Spec.PolicyTypes = append(dst.Spec.PolicyTypes[:0:0], src.Spec.PolicyTypes...)
+	dst.Spec.Ingress = nil
+	for _, rule := range src.Spec.Ingress {
+		rule := rule.DeepCopy()
+		dst.Spec.Ingress = append(dst.Spec.Ingress, v1alpha3.FQDNNetworkPolicyIngressRule{
+			Ports: rule.Ports,
+			From:  convertPeersTo(rule.From),
+		})
+	}
+	dst.Spec.Egress = nil
+	for _, rule := range src.Spec.Egress {
+		rule := rule.DeepCopy()
+		dst.Spec.Egress = append(dst.Spec.Egress, v1alpha3.FQDNNetworkPolicyEgressRule{
+			Ports: rule.Ports,
+			To:    convertPeersTo(rule.To),
+		})
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = v1alpha3.FQDNNetworkPolicyStatus{
+		State:              v1alpha3.State(status.State),
+		Reason:             status.Reason,
+		LastSyncTime:       status.LastSyncTime,
+		NextSyncTime:       status.NextSyncTime,
+		Attempts:           status.Attempts,
+		OmittedFQDNs:       status.OmittedFQDNs,
+		WildcardHostnames:  status.WildcardHostnames,
+		ObservedGeneration: status.ObservedGeneration,
+		Conditions:         status.Conditions,
+	}
+	for _, fqdn := range status.FQDNs {
+		converted := v1alpha3.FQDNStatus{
+			FQDN:             fqdn.FQDN,
+			Hostnames:        fqdn.Hostnames,
+			CNAMEChain:       fqdn.CNAMEChain,
+			OmittedAddresses: fqdn.OmittedAddresses,
+			TTL:              fqdn.TTL,
+			Nameserver:       fqdn.Nameserver,
+			LastResolved:     fqdn.LastResolved,
+			LastError:        fqdn.LastError,
+		}
+		for _, address := range fqdn.Addresses {
+			converted.Addresses = append(converted.Addresses, v1alpha3.AddressStatus(address))
+		}
+		dst.Status.FQDNs = append(dst.Status.FQDNs, converted)
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1alpha3 hub to this FQDNNetworkPolicy, moving the
+// aaaa-lookups and delete-policy annotations to the spec
+func (dst *FQDNNetworkPolicy) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1alpha3.FQDNNetworkPolicy)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", srcRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec.AAAALookups = ResolveAAAALookups
+	if dst.Annotations[v1alpha3.AAAALookupsAnnotation] == skipAAAALookupsAnnotation {
+		dst.Spec.AAAALookups = SkipAAAALookups
+		dst.Annotations = setAnnotation(dst.Annotations, v1alpha3.AAAALookupsAnnotation, "", false)
+	}
+	dst.Spec.DeletePolicy = DeleteNetworkPolicy
+	if dst.Annotations[v1alpha3.DeletePolicyAnnotation] == abandonNetworkPolicyAnnotation {
+		dst.Spec.DeletePolicy = AbandonNetworkPolicy
+		dst.Annotations = setAnnotation(dst.Annotations, v1alpha3.DeletePolicyAnnotation, "", false)
+	}
+
+	dst.Spec.PodSelector = *src.Spec.PodSelector.DeepCopy()
+	dst.Spec.PolicyTypes = append(dst.Spec.PolicyTypes[:0:0], src.Spec.PolicyTypes...)
+	dst.Spec.Ingress = nil
+	for _, rule := range src.Spec.Ingress {
+		rule := rule.DeepCopy()
+		dst.Spec.Ingress = append(dst.Spec.Ingress, FQDNNetworkPolicyIngressRule{
+			Ports: rule.Ports,
+			From:  convertPeersFrom(rule.From),
+		})
+	}
+	dst.Spec.Egress = nil
+	for _, rule := range src.Spec.Egress {
+		rule := rule.DeepCopy()
+		dst.Spec.Egress = append(dst.Spec.Egress, FQDNNetworkPolicyEgressRule{
+			Ports: rule.Ports,
+			To:    convertPeersFrom(rule.To),
+		})
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = FQDNNetworkPolicyStatus{
+		State:              State(status.State),
+		Reason:             status.Reason,
+		LastSyncTime:       status.LastSyncTime,
+		NextSyncTime:       status.NextSyncTime,
+		Attempts:           status.Attempts,
+		OmittedFQDNs:       status.OmittedFQDNs,
+		WildcardHostnames:  status.WildcardHostnames,
+		ObservedGeneration: status.ObservedGeneration,
+		Conditions:         status.Conditions,
+	}
+	for _, fqdn := range status.FQDNs {
+		converted := FQDNStatus{
+			FQDN:             fqdn.FQDN,
+			Hostnames:        fqdn.Hostnames,
+			CNAMEChain:       fqdn.CNAMEChain,
+			OmittedAddresses: fqdn.OmittedAddresses,
+			TTL:              fqdn.TTL,
+			Nameserver:       fqdn.Nameserver,
+			LastResolved:     fqdn.LastResolved,
+			LastError:        fqdn.LastError,
+		}
+		for _, address := range fqdn.Addresses {
+			converted.Addresses = append(converted.Addresses, AddressStatus(address))
+		}
+		dst.Status.FQDNs = append(dst.Status.FQDNs, converted)
+	}
+	return nil
+}
+
+// convertPeersTo converts peers to their v1alpha3 version
+func convertPeersTo(peers []FQDNNetworkPolicyPeer) []v1alpha3.FQDNNetworkPolicyPeer {
+	if peers == nil {
+		return nil
+	}
+	converted := make([]v1alpha3.FQDNNetworkPolicyPeer, 0, len(peers))
+	for _, peer := range peers {
+		c := v1alpha3.FQDNNetworkPolicyPeer{
+			FQDNs:             peer.FQDNs,
+			PodSelector:       peer.PodSelector,
+			NamespaceSelector: peer.NamespaceSelector,
+			IPBlock:           peer.IPBlock,
+		}
+		if peer.FQDNSetRef != nil {
+			c.FQDNSetRef = &v1alpha3.FQDNSetReference{Kind: peer.FQDNSetRef.Kind, Name: peer.FQDNSetRef.Name}
+		}
+		converted = append(converted, c)
+	}
+	return converted
+}
+
+// convertPeersFrom converts v1alpha3 peers to their version in this package
+func convertPeersFrom(peers []v1alpha3.FQDNNetworkPolicyPeer) []FQDNNetworkPolicyPeer {
+	if peers == nil {
+		return nil
+	}
+	converted := make([]FQDNNetworkPolicyPeer, 0, len(peers))
+	for _, peer := range peers {
+		c := FQDNNetworkPolicyPeer{
+			FQDNs:             peer.FQDNs,
+			PodSelector:       peer.PodSelector,
+			NamespaceSelector: peer.NamespaceSelector,
+			IPBlock:           peer.IPBlock,
+		}
+		if peer.FQDNSetRef != nil {
+			c.FQDNSetRef = &FQDNSetReference{Kind: peer.FQDNSetRef.Kind, Name: peer.FQDNSetRef.Name}
+		}
+		converted = append(converted, c)
+	}
+	return converted
+}
+
+// setAnnotation sets the annotation key of annotations to value if set is
+// true. Otherwise it removes the annotation if it's value, or if value is
+// empty. The annotations are nil rather than empty.
+func setAnnotation(annotations map[string]string, key string, value string, set bool) map[string]string {
+	switch {
+	case set:
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[key] = value
+	case value == "" || annotations[key] == value:
+		delete(annotations, key)
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
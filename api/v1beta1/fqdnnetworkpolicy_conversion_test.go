@@ -0,0 +1,148 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+func TestConvertTo(t *testing.T) {
+	src := &FQDNNetworkPolicy{}
+	yamlFile, err := os.ReadFile("../../config/samples/networking_v1beta1_fqdnnetworkpolicy_valid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(yamlFile, src); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := &v1alpha3.FQDNNetworkPolicy{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if got := hub.Annotations[v1alpha3.AAAALookupsAnnotation]; got != "skip" {
+		t.Errorf("expected the aaaa-lookups annotation to be skip, got %q", got)
+	}
+	if got := hub.Annotations[v1alpha3.DeletePolicyAnnotation]; got != "abandon" {
+		t.Errorf("expected the delete-policy annotation to be abandon, got %q", got)
+	}
+	if len(hub.Spec.Egress) != 1 || len(hub.Spec.Egress[0].To) != 1 ||
+		len(hub.Spec.Egress[0].To[0].FQDNs) != 2 || len(hub.Spec.Egress[0].Ports) != 1 {
+		t.Errorf("unexpected egress rules %+v", hub.Spec.Egress)
+	}
+	if src.Annotations != nil {
+		t.Errorf("the conversion changed the annotations of the source: %v", src.Annotations)
+	}
+
+	dst := &FQDNNetworkPolicy{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	// The conversion webhook sets the TypeMeta
+	dst.TypeMeta = src.TypeMeta
+	if !equality.Semantic.DeepEqual(src, dst) {
+		t.Errorf("round trip through v1alpha3 changed the FQDNNetworkPolicy:\n%+v\n%+v", src, dst)
+	}
+}
+
+func TestConvertFrom(t *testing.T) {
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		aaaaLookups  AAAALookups
+		deletePolicy DeletePolicy
+		remaining    map[string]string
+	}{
+		{
+			name:         "no annotations",
+			aaaaLookups:  ResolveAAAALookups,
+			deletePolicy: DeleteNetworkPolicy,
+		},
+		{
+			name: "promoted annotations",
+			annotations: map[string]string{
+				v1alpha3.AAAALookupsAnnotation:  "skip",
+				v1alpha3.DeletePolicyAnnotation: "abandon",
+				"example.com/other":             "kept",
+			},
+			aaaaLookups:  SkipAAAALookups,
+			deletePolicy: AbandonNetworkPolicy,
+			remaining:    map[string]string{"example.com/other": "kept"},
+		},
+		{
+			name:         "unknown values",
+			annotations:  map[string]string{v1alpha3.AAAALookupsAnnotation: "resolve"},
+			aaaaLookups:  ResolveAAAALookups,
+			deletePolicy: DeleteNetworkPolicy,
+			remaining:    map[string]string{v1alpha3.AAAALookupsAnnotation: "resolve"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := (&v1alpha3.FQDNNetworkPolicy{}).GetValidMixedPeersResource()
+			hub.Annotations = tt.annotations
+			hub.Spec.Egress[0].To = append(hub.Spec.Egress[0].To, v1alpha3.FQDNNetworkPolicyPeer{
+				FQDNSetRef: &v1alpha3.FQDNSetReference{Kind: v1alpha3.ClusterFQDNSetKind, Name: "saas"}})
+			hub.Status = v1alpha3.FQDNNetworkPolicyStatus{
+				State:        v1alpha3.ActiveState,
+				LastSyncTime: &now,
+				FQDNs: []v1alpha3.FQDNStatus{{
+					FQDN:      "example.com",
+					Addresses: []v1alpha3.AddressStatus{{IP: "192.0.2.1", LastSeen: now}},
+				}},
+				WildcardHostnames: []string{"api.example.com"},
+				Conditions:        []metav1.Condition{{Type: v1alpha3.ReadyCondition, Status: metav1.ConditionTrue}},
+			}
+			original := hub.DeepCopy()
+
+			dst := &FQDNNetworkPolicy{}
+			if err := dst.ConvertFrom(hub); err != nil {
+				t.Fatal(err)
+			}
+			if dst.Spec.AAAALookups != tt.aaaaLookups {
+				t.Errorf("expected aaaaLookups %q, got %q", tt.aaaaLookups, dst.Spec.AAAALookups)
+			}
+			if dst.Spec.DeletePolicy != tt.deletePolicy {
+				t.Errorf("expected deletePolicy %q, got %q", tt.deletePolicy, dst.Spec.DeletePolicy)
+			}
+			if !equality.Semantic.DeepEqual(dst.Annotations, tt.remaining) {
+				t.Errorf("expected the annotations %v, got %v", tt.remaining, dst.Annotations)
+			}
+			if !equality.Semantic.DeepEqual(hub, original) {
+				t.Error("the conversion changed the v1alpha3 FQDNNetworkPolicy")
+			}
+
+			roundTrip := &v1alpha3.FQDNNetworkPolicy{}
+			if err := dst.ConvertTo(roundTrip); err != nil {
+				t.Fatal(err)
+			}
+			roundTrip.TypeMeta = hub.TypeMeta
+			if !equality.Semantic.DeepEqual(roundTrip, hub) {
+				t.Errorf("round trip through v1beta1 changed the FQDNNetworkPolicy:\n%+v\n%+v", hub, roundTrip)
+			}
+		})
+	}
+}
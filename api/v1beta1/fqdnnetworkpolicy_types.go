@@ -0,0 +1,222 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type State string
+
+const (
+	// PendingState is the state of the FQDNNetworkPolicy when it's first created
+	PendingState State = "Pending"
+	// ActiveState is the state of the FQDNNetworkPolicy when the associated NetworkPolicy is created
+	ActiveState State = "Active"
+	// DestroyingState is the state of the FQDNNetworkPolicy when it's being destroyed
+	DestroyingState State = "Destroying"
+)
+
+// AAAALookups decides whether the AAAA records of the FQDNs are resolved
+// +kubebuilder:validation:Enum=Resolve;Skip
+type AAAALookups string
+
+const (
+	// ResolveAAAALookups adds the IPv6 addresses of the FQDNs to the NetworkPolicy
+	ResolveAAAALookups AAAALookups = "Resolve"
+	// SkipAAAALookups only adds the IPv4 addresses of the FQDNs to the NetworkPolicy
+	SkipAAAALookups AAAALookups = "Skip"
+)
+
+// DeletePolicy decides what happens to the NetworkPolicy when the
+// FQDNNetworkPolicy is deleted
+// +kubebuilder:validation:Enum=Delete;Abandon
+type DeletePolicy string
+
+const (
+	// DeleteNetworkPolicy garbage collects the NetworkPolicy along with the
+	// FQDNNetworkPolicy
+	DeleteNetworkPolicy DeletePolicy = "Delete"
+	// AbandonNetworkPolicy leaves the NetworkPolicy in place
+	AbandonNetworkPolicy DeletePolicy = "Abandon"
+)
+
+// FQDNNetworkPolicySpec defines the desired state of FQDNNetworkPolicy
+type FQDNNetworkPolicySpec struct {
+	PodSelector metav1.LabelSelector           `json:"podSelector" protobuf:"bytes,1,opt,name=podSelector"`
+	Ingress     []FQDNNetworkPolicyIngressRule `json:"ingress,omitempty" protobuf:"bytes,2,rep,name=ingress"`
+	Egress      []FQDNNetworkPolicyEgressRule  `json:"egress,omitempty" protobuf:"bytes,3,rep,name=egress"`
+	PolicyTypes []networking.PolicyType        `json:"policyTypes,omitempty" protobuf:"bytes,4,rep,name=policyTypes,casttype=PolicyType"`
+	// AAAALookups is Skip to leave the IPv6 addresses of the FQDNs out of
+	// the NetworkPolicy. Defaults to Resolve.
+	// +kubebuilder:default=Resolve
+	// +optional
+	AAAALookups AAAALookups `json:"aaaaLookups,omitempty"`
+	// DeletePolicy is Abandon to keep the NetworkPolicy when the
+	// FQDNNetworkPolicy is deleted. Defaults to Delete.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletePolicy DeletePolicy `json:"deletePolicy,omitempty"`
+}
+
+// FQDNNetworkPolicyStatus defines the observed state of FQDNNetworkPolicy
+type FQDNNetworkPolicyStatus struct {
+	State        State        `json:"state"`
+	Reason       string       `json:"reason,omitempty"`
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	NextSyncTime *metav1.Time `json:"nextSyncTime,omitempty"`
+	// Attempts is the number of consecutive failed attempts to sync the
+	// NetworkPolicy. The next attempt happens at NextSyncTime.
+	Attempts int32 `json:"attempts,omitempty"`
+	// FQDNs lists how the FQDNs of the FQDNNetworkPolicy were resolved
+	FQDNs []FQDNStatus `json:"fqdns,omitempty"`
+	// OmittedFQDNs is the number of FQDNs left out of FQDNs to bound the
+	// size of the status
+	OmittedFQDNs int32 `json:"omittedFQDNs,omitempty"`
+	// WildcardHostnames lists hostnames the wildcard FQDNs of the
+	// FQDNNetworkPolicy are expanded to, along with the ones observed in the
+	// DNS query log. The controller doesn't write it: it's set through the
+	// status subresource by whoever knows the hostnames.
+	// +optional
+	WildcardHostnames []string `json:"wildcardHostnames,omitempty"`
+	// ObservedGeneration is the generation of the FQDNNetworkPolicy
+	// last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the current state of the FQDNNetworkPolicy
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// FQDNStatus describes how a FQDN of the FQDNNetworkPolicy was resolved
+type FQDNStatus struct {
+	// FQDN is the name as written in the FQDNNetworkPolicy
+	FQDN string `json:"fqdn"`
+	// Hostnames lists the hostnames resolved for a wildcard FQDN
+	Hostnames []string `json:"hostnames,omitempty"`
+	// CNAMEChain lists the canonical names followed to resolve the FQDN, in order
+	CNAMEChain []string `json:"cnameChain,omitempty"`
+	// Addresses lists the addresses of the FQDN in the NetworkPolicy,
+	// including the ones still retained after they stopped being resolved
+	Addresses []AddressStatus `json:"addresses,omitempty"`
+	// OmittedAddresses is the number of addresses left out of Addresses
+	// to bound the size of the status
+	OmittedAddresses int32 `json:"omittedAddresses,omitempty"`
+	// TTL is the lowest TTL, in seconds, of the records of the FQDN
+	TTL int32 `json:"ttl,omitempty"`
+	// Nameserver is the nameserver that answered the last query
+	Nameserver string `json:"nameserver,omitempty"`
+	// LastResolved is the last time the FQDN was resolved successfully
+	LastResolved *metav1.Time `json:"lastResolved,omitempty"`
+	// LastError is the error of the last resolution of the FQDN, if it failed,
+	// or its outcome, such as NXDOMAIN, if it found no address
+	LastError string `json:"lastError,omitempty"`
+}
+
+// AddressStatus is an address of a FQDN in the NetworkPolicy
+type AddressStatus struct {
+	// IP is the IPv4 or IPv6 address
+	IP string `json:"ip"`
+	// LastSeen is the last time the address was resolved for the FQDN
+	LastSeen metav1.Time `json:"lastSeen"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// FQDNNetworkPolicy is the Schema for the fqdnnetworkpolicies API
+type FQDNNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FQDNNetworkPolicySpec   `json:"spec,omitempty"`
+	Status FQDNNetworkPolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// FQDNNetworkPolicyList contains a list of FQDNNetworkPolicy
+type FQDNNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FQDNNetworkPolicy `json:"items"`
+}
+
+// FQDNNetworkPolicyEgressRule describes a particular set of
+// traffic that is allowed out of pods matched by a
+// FQDNNetworkPolicySpec's podSelector. The traffic must match
+// both ports and to.
+type FQDNNetworkPolicyEgressRule struct {
+	Ports []networking.NetworkPolicyPort `json:"ports,omitempty"`
+	To    []FQDNNetworkPolicyPeer        `json:"to"`
+}
+
+// FQDNNetworkPolicyIngressRule describes a particular set of
+// traffic that is allowed into pods matched by a
+// FQDNNetworkPolicySpec's podSelector. The traffic must match
+// both ports and from.
+type FQDNNetworkPolicyIngressRule struct {
+	Ports []networking.NetworkPolicyPort `json:"ports,omitempty"`
+	From  []FQDNNetworkPolicyPeer        `json:"from"`
+}
+
+// FQDNNetworkPolicyPeer represents the FQDNs, or the pods or CIDR blocks,
+// that the FQDNNetworkPolicy allows connections to. The FQDNs and FQDN set
+// can't be combined with the other fields in a single peer.
+type FQDNNetworkPolicyPeer struct {
+	// FQDNs are the hostnames to allow. The leftmost label can be a *
+	// wildcard matching a single label, such as *.example.com: the
+	// hostnames matching it are taken from the wildcardHostnames status
+	// field of the FQDNNetworkPolicy, and from the DNS query log if the
+	// controller is configured to read one.
+	// +optional
+	FQDNs []string `json:"fqdns,omitempty"`
+	// FQDNSetRef references a FQDNSet or ClusterFQDNSet whose FQDNs are
+	// allowed along with the FQDNs of the peer
+	// +optional
+	FQDNSetRef *FQDNSetReference `json:"fqdnSetRef,omitempty"`
+	// PodSelector, NamespaceSelector and IPBlock are copied as is to the
+	// NetworkPolicy, see the NetworkPolicyPeer of NetworkPolicies.
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// +optional
+	IPBlock *networking.IPBlock `json:"ipBlock,omitempty"`
+}
+
+// FQDNSetReference references the FQDNSet or ClusterFQDNSet whose FQDNs a
+// FQDNNetworkPolicyPeer allows
+type FQDNSetReference struct {
+	// Kind is FQDNSet, for a FQDNSet in the namespace of the
+	// FQDNNetworkPolicy, or ClusterFQDNSet. Defaults to FQDNSet.
+	// +kubebuilder:validation:Enum=FQDNSet;ClusterFQDNSet
+	// +kubebuilder:default=FQDNSet
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Name is the name of the set
+	Name string `json:"name"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FQDNNetworkPolicy{}, &FQDNNetworkPolicyList{})
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachingResolver is a Resolver caching the answers of another Resolver
+// for the duration of their TTL. A single CachingResolver is shared by all
+// the FQDNNetworkPolicies, so the number of queries sent to the nameservers
+// depends on the number of distinct FQDNs rather than on the number of
+// FQDNNetworkPolicies.
+type CachingResolver struct {
+	resolver Resolver
+
+	mu       sync.Mutex
+	entries  map[query]*cacheEntry
+	inflight map[query]*inflightQuery
+	// lastPurge is when the expired entries were last removed
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+// cacheEntry is an answer stored in the cache
+type cacheEntry struct {
+	answer  *Answer
+	stored  time.Time
+	expires time.Time
+}
+
+// inflightQuery is a query being sent to the nameservers. Concurrent lookups
+// of the same FQDN and record type wait for it instead of sending their own.
+type inflightQuery struct {
+	done   chan struct{}
+	answer *Answer
+	err    error
+}
+
+// purgeInterval is how often expired entries are removed from the cache
+const purgeInterval = time.Minute
+
+var _ Resolver = &CachingResolver{}
+
+// NewCachingResolver returns a CachingResolver in front of resolver
+func NewCachingResolver(resolver Resolver) *CachingResolver {
+	return &CachingResolver{
+		resolver: resolver,
+		entries:  map[query]*cacheEntry{},
+		inflight: map[query]*inflightQuery{},
+		now:      time.Now,
+	}
+}
+
+// Resolve implements Resolver
+func (c *CachingResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	// "github.com" and "GitHub.com" are the same FQDN, but "github.com." isn't
+	// looked up in the search list
+	key := query{fqdn: strings.ToLower(fqdn), recordType: recordType}
+
+	c.mu.Lock()
+	now := c.now()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		dnsCacheHits.Inc()
+		return e.answer.age(now.Sub(e.stored)), nil
+	}
+	if q, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		// Waiting for the answer of another lookup doesn't send any query
+		dnsCacheHits.Inc()
+		select {
+		case <-q.done:
+			return q.answer, q.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	dnsCacheMisses.Inc()
+	q := &inflightQuery{done: make(chan struct{})}
+	c.inflight[key] = q
+	c.mu.Unlock()
+
+	q.answer, q.err = c.resolver.Resolve(ctx, fqdn, recordType)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, key)
+	close(q.done)
+	if q.err == nil && (len(q.answer.Addresses) > 0 || q.answer.NegativeTTL > 0) {
+		// Negative answers are cached for the TTL of their SOA record. Those
+		// without SOA record aren't, as we don't know for how long they
+		// are valid.
+		if ttl := q.answer.MinTTL(math.MaxUint32); ttl > 0 {
+			now := c.now()
+			c.entries[key] = &cacheEntry{
+				answer:  q.answer,
+				stored:  now,
+				expires: now.Add(time.Duration(ttl) * time.Second),
+			}
+		}
+	}
+	c.purge()
+	return q.answer, q.err
+}
+
+// purge removes the expired entries from the cache, at most once per
+// purgeInterval. c.mu must be held.
+func (c *CachingResolver) purge() {
+	now := c.now()
+	if now.Sub(c.lastPurge) >= purgeInterval {
+		for key, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastPurge = now
+	}
+	dnsCacheEntries.Set(float64(len(c.entries)))
+}
+
+// age returns a copy of the answer with the TTLs of its records lowered by
+// the time spent in the cache.
+func (a *Answer) age(d time.Duration) *Answer {
+	elapsed := uint32(d / time.Second)
+	aged := &Answer{Nameserver: a.Nameserver, Outcome: a.Outcome, NegativeTTL: subTTL(a.NegativeTTL, elapsed)}
+	for _, address := range a.Addresses {
+		address.TTL = subTTL(address.TTL, elapsed)
+		aged.Addresses = append(aged.Addresses, address)
+	}
+	for _, cname := range a.CNAMEs {
+		cname.TTL = subTTL(cname.TTL, elapsed)
+		aged.CNAMEs = append(aged.CNAMEs, cname)
+	}
+	return aged
+}
+
+// subTTL subtracts elapsed from ttl, stopping at 0
+func subTTL(ttl uint32, elapsed uint32) uint32 {
+	if elapsed >= ttl {
+		return 0
+	}
+	return ttl - elapsed
+}
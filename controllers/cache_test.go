@@ -0,0 +1,210 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingResolver is a Resolver answering with a single address, counting
+// the queries it receives
+type countingResolver struct {
+	mu      sync.Mutex
+	queries int
+	ttl     uint32
+}
+
+func (c *countingResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries++
+	return &Answer{Addresses: []Address{{IP: net.ParseIP("192.0.2.1"), TTL: c.ttl}}}, nil
+}
+
+func TestCachingResolver(t *testing.T) {
+	upstream := &countingResolver{ttl: 30}
+	c := NewCachingResolver(upstream)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	hits := testutil.ToFloat64(dnsCacheHits)
+	misses := testutil.ToFloat64(dnsCacheMisses)
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.Resolve(context.Background(), "api.github.com", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upstream.queries != 1 {
+		t.Errorf("expected a single upstream query, got %d", upstream.queries)
+	}
+	if d := testutil.ToFloat64(dnsCacheHits) - hits; d != 4 {
+		t.Errorf("expected 4 cache hits, got %v", d)
+	}
+	if d := testutil.ToFloat64(dnsCacheMisses) - misses; d != 1 {
+		t.Errorf("expected 1 cache miss, got %v", d)
+	}
+
+	// the TTL of cached answers decreases with time, and the case of the
+	// FQDN doesn't matter
+	now = now.Add(10 * time.Second)
+	a, err := c.Resolve(context.Background(), "API.github.com", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Addresses[0].TTL != 20 {
+		t.Errorf("expected a TTL of 20, got %d", a.Addresses[0].TTL)
+	}
+
+	// but the trailing dot does, the absolute name isn't looked up in the
+	// search list
+	if _, err := c.Resolve(context.Background(), "api.github.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	if upstream.queries != 2 {
+		t.Errorf("expected the absolute name to be queried separately, got %d queries", upstream.queries)
+	}
+
+	// the record type is part of the key
+	if _, err := c.Resolve(context.Background(), "api.github.com", dns.TypeAAAA); err != nil {
+		t.Fatal(err)
+	}
+	if upstream.queries != 3 {
+		t.Errorf("expected AAAA records to be queried separately, got %d queries", upstream.queries)
+	}
+
+	// expired entries are queried again
+	now = now.Add(30 * time.Second)
+	if _, err := c.Resolve(context.Background(), "api.github.com", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	if upstream.queries != 4 {
+		t.Errorf("expected the expired entry to be queried again, got %d queries", upstream.queries)
+	}
+}
+
+// blockingResolver is a countingResolver answering once unblocked
+type blockingResolver struct {
+	countingResolver
+	unblock chan struct{}
+}
+
+func (b *blockingResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	<-b.unblock
+	return b.countingResolver.Resolve(ctx, fqdn, recordType)
+}
+
+func TestCachingResolverInflight(t *testing.T) {
+	upstream := &blockingResolver{countingResolver{ttl: 30}, make(chan struct{})}
+	c := NewCachingResolver(upstream)
+	hits := testutil.ToFloat64(dnsCacheHits)
+	misses := testutil.ToFloat64(dnsCacheMisses)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Resolve(context.Background(), "api.github.com", dns.TypeA); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// waiting for the lookups to be waiting for the first one
+	for testutil.ToFloat64(dnsCacheHits)-hits+testutil.ToFloat64(dnsCacheMisses)-misses < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	close(upstream.unblock)
+	wg.Wait()
+	if upstream.queries != 1 {
+		t.Errorf("expected a single upstream query, got %d", upstream.queries)
+	}
+	// the lookups waiting for the first one don't send any query
+	if d := testutil.ToFloat64(dnsCacheHits) - hits; d != 2 {
+		t.Errorf("expected 2 cache hits, got %v", d)
+	}
+	if d := testutil.ToFloat64(dnsCacheMisses) - misses; d != 1 {
+		t.Errorf("expected 1 cache miss, got %v", d)
+	}
+}
+
+func TestCachingResolverZeroTTL(t *testing.T) {
+	upstream := &countingResolver{ttl: 0}
+	c := NewCachingResolver(upstream)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Resolve(context.Background(), "example.com", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upstream.queries != 3 {
+		t.Errorf("answers with a TTL of 0 shouldn't be cached, got %d queries", upstream.queries)
+	}
+}
+
+// negativeResolver is a Resolver answering that the FQDNs don't exist,
+// counting the queries it receives
+type negativeResolver struct {
+	countingResolver
+}
+
+func (n *negativeResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.queries++
+	return &Answer{Outcome: OutcomeNXDomain, NegativeTTL: n.ttl}, nil
+}
+
+func TestCachingResolverNegativeAnswers(t *testing.T) {
+	upstream := &negativeResolver{countingResolver{ttl: 30}}
+	c := NewCachingResolver(upstream)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Resolve(context.Background(), "nx.example.com", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upstream.queries != 1 {
+		t.Errorf("expected the negative answer to be cached, got %d queries", upstream.queries)
+	}
+	now = now.Add(10 * time.Second)
+	a, err := c.Resolve(context.Background(), "nx.example.com", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Outcome != OutcomeNXDomain || a.NegativeTTL != 20 {
+		t.Errorf("unexpected cached answer %+v", a)
+	}
+
+	// negative answers without SOA record aren't cached
+	upstream.ttl = 0
+	for i := 0; i < 2; i++ {
+		if _, err := c.Resolve(context.Background(), "nodata.example.com", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upstream.queries != 3 {
+		t.Errorf("expected negative answers without TTL not to be cached, got %d queries", upstream.queries)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/netip"
+	"sort"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+// aggregatePeers returns peers without the duplicate CIDRs, nor the CIDRs
+// included in another one. Two adjacent CIDRs of the same size are merged
+// into the CIDR covering exactly both of them, as long as it's at most
+// maxWidening bits shorter than a single address. The CIDRs are sorted, and
+// followed by the peers that aren't plain CIDRs, kept as is.
+func aggregatePeers(peers []networking.NetworkPolicyPeer, maxWidening int) []networking.NetworkPolicyPeer {
+	prefixes := map[netip.Prefix]bool{}
+	others := []networking.NetworkPolicyPeer{}
+	for _, peer := range peers {
+		if peer.IPBlock == nil || len(peer.IPBlock.Except) > 0 ||
+			peer.PodSelector != nil || peer.NamespaceSelector != nil {
+			others = append(others, peer)
+			continue
+		}
+		prefix, err := netip.ParsePrefix(peer.IPBlock.CIDR)
+		if err != nil {
+			others = append(others, peer)
+			continue
+		}
+		prefixes[prefix.Masked()] = true
+	}
+
+	// Merging siblings until there is nothing left to merge, as merging two
+	// CIDRs may give a sibling to another one
+	for merged := true; merged; {
+		merged = false
+		for prefix := range prefixes {
+			if !prefixes[prefix] || prefix.Bits() == 0 ||
+				prefix.Addr().BitLen()-prefix.Bits()+1 > maxWidening {
+				continue
+			}
+			sibling := siblingPrefix(prefix)
+			if !prefixes[sibling] {
+				continue
+			}
+			delete(prefixes, prefix)
+			delete(prefixes, sibling)
+			prefixes[netip.PrefixFrom(prefix.Addr(), prefix.Bits()-1).Masked()] = true
+			merged = true
+		}
+	}
+
+	sorted := make([]netip.Prefix, 0, len(prefixes))
+	for prefix := range prefixes {
+		if !coveredPrefix(prefixes, prefix) {
+			sorted = append(sorted, prefix)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Addr() != sorted[j].Addr() {
+			return sorted[i].Addr().Less(sorted[j].Addr())
+		}
+		return sorted[i].Bits() < sorted[j].Bits()
+	})
+	result := make([]networking.NetworkPolicyPeer, 0, len(sorted)+len(others))
+	for _, prefix := range sorted {
+		result = append(result, networking.NetworkPolicyPeer{
+			IPBlock: &networking.IPBlock{CIDR: prefix.String()}})
+	}
+	return append(result, others...)
+}
+
+// siblingPrefix returns the other half of the CIDR prefix is half of
+func siblingPrefix(prefix netip.Prefix) netip.Prefix {
+	b := prefix.Addr().AsSlice()
+	i := prefix.Bits() - 1
+	b[i/8] ^= 0x80 >> (i % 8)
+	addr, _ := netip.AddrFromSlice(b)
+	return netip.PrefixFrom(addr, prefix.Bits())
+}
+
+// coveredPrefix returns whether a shorter CIDR of prefixes includes prefix
+func coveredPrefix(prefixes map[netip.Prefix]bool, prefix netip.Prefix) bool {
+	for bits := prefix.Bits() - 1; bits >= 0; bits-- {
+		if prefixes[netip.PrefixFrom(prefix.Addr(), bits).Masked()] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cidrPeers returns a peer per CIDR
+func cidrPeers(cidrs ...string) []networking.NetworkPolicyPeer {
+	peers := []networking.NetworkPolicyPeer{}
+	for _, cidr := range cidrs {
+		peers = append(peers, networking.NetworkPolicyPeer{IPBlock: &networking.IPBlock{CIDR: cidr}})
+	}
+	return peers
+}
+
+// peerCIDRs returns the CIDRs of the peers, or their description if they
+// aren't plain CIDRs
+func peerCIDRs(peers []networking.NetworkPolicyPeer) []string {
+	cidrs := []string{}
+	for _, peer := range peers {
+		if peer.IPBlock != nil && peer.PodSelector == nil {
+			cidrs = append(cidrs, peer.IPBlock.CIDR)
+		} else {
+			cidrs = append(cidrs, peer.String())
+		}
+	}
+	return cidrs
+}
+
+func TestAggregatePeers(t *testing.T) {
+	addresses := cidrPeers("192.0.2.3/32", "192.0.2.1/32", "192.0.2.2/32", "192.0.2.0/32", "192.0.2.1/32",
+		"192.0.2.4/32", "192.0.2.6/32", "198.51.100.7/32",
+		"2001:db8::1/128", "2001:db8::/128", "2001:db8::1/128")
+	for _, tc := range []struct {
+		maxWidening int
+		expected    []string
+	}{
+		{0, []string{"192.0.2.0/32", "192.0.2.1/32", "192.0.2.2/32", "192.0.2.3/32", "192.0.2.4/32",
+			"192.0.2.6/32", "198.51.100.7/32", "2001:db8::/128", "2001:db8::1/128"}},
+		{1, []string{"192.0.2.0/31", "192.0.2.2/31", "192.0.2.4/32", "192.0.2.6/32", "198.51.100.7/32",
+			"2001:db8::/127"}},
+		// 192.0.2.4/32 and 192.0.2.6/32 aren't adjacent
+		{8, []string{"192.0.2.0/30", "192.0.2.4/32", "192.0.2.6/32", "198.51.100.7/32", "2001:db8::/127"}},
+	} {
+		if cidrs := peerCIDRs(aggregatePeers(addresses, tc.maxWidening)); !equalStrings(cidrs, tc.expected) {
+			t.Errorf("expected %v with a widening of %d, got %v", tc.expected, tc.maxWidening, cidrs)
+		}
+	}
+
+	// CIDRs included in another one are removed, the other peers are kept
+	selector := networking.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{}}
+	peers := append(cidrPeers("192.0.2.1/32", "192.0.2.0/24", "192.0.2.10/24"), selector)
+	cidrs := peerCIDRs(aggregatePeers(peers, 0))
+	if !equalStrings(cidrs, []string{"192.0.2.0/24", selector.String()}) {
+		t.Errorf("unexpected peers %v", cidrs)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+// ClusterFQDNNetworkPolicyReconciler reconciles a ClusterFQDNNetworkPolicy
+// object, creating a FQDNNetworkPolicy of the same name in each of the
+// namespaces it selects. The FQDNNetworkPolicyReconciler then takes care of
+// their NetworkPolicies.
+type ClusterFQDNNetworkPolicyReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+var (
+	// clusterOwnerAnnotation is set on the FQDNNetworkPolicies created from a
+	// ClusterFQDNNetworkPolicy to its name
+	clusterOwnerAnnotation = "fqdnnetworkpolicies.networking.gke.io/cluster-owned-by"
+	// annotationPrefix is the prefix of the annotations configuring the
+	// controller, copied from the ClusterFQDNNetworkPolicies to their
+	// FQDNNetworkPolicies
+	annotationPrefix = "fqdnnetworkpolicies.networking.gke.io/"
+	// clusterOwnerKey indexes the FQDNNetworkPolicies by the name of the
+	// ClusterFQDNNetworkPolicy controlling them
+	clusterOwnerKey = ".metadata.controller.clusterfqdnnetworkpolicy"
+)
+
+//+kubebuilder:rbac:groups=networking.gke.io,resources=clusterfqdnnetworkpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.gke.io,resources=clusterfqdnnetworkpolicies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=networking.gke.io,resources=clusterfqdnnetworkpolicies/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Reconcile creates, updates and deletes the FQDNNetworkPolicies of a
+// ClusterFQDNNetworkPolicy so that there is one in each selected namespace
+func (r *ClusterFQDNNetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("clusterfqdnnetworkpolicy", req.Name)
+
+	clusterPolicy := &networkingv1alpha3.ClusterFQDNNetworkPolicy{}
+	if err := r.Get(ctx, req.NamespacedName, clusterPolicy); err != nil {
+		// The FQDNNetworkPolicies of a deleted ClusterFQDNNetworkPolicy are
+		// garbage collected
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !clusterPolicy.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&clusterPolicy.Spec.NamespaceSelector)
+	if err != nil {
+		// Waiting for the selector to be fixed, retrying won't help
+		log.Error(err, "invalid namespace selector")
+		r.setReadyCondition(clusterPolicy, metav1.ConditionFalse, "InvalidNamespaceSelector", err.Error())
+		return ctrl.Result{}, r.Status().Update(ctx, clusterPolicy)
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.Error(err, "unable to list namespaces")
+		return ctrl.Result{}, err
+	}
+	owned := &networkingv1alpha3.FQDNNetworkPolicyList{}
+	if err := r.List(ctx, owned, client.MatchingFields{clusterOwnerKey: clusterPolicy.Name}); err != nil {
+		log.Error(err, "unable to list FQDNNetworkPolicies")
+		return ctrl.Result{}, err
+	}
+
+	selected := map[string]bool{}
+	applied := []string{}
+	conflicts := []string{}
+	// The namespaces failing to sync don't stop the others from being synced
+	failed := []string{}
+	errs := []error{}
+	for _, namespace := range namespaces.Items {
+		// Not creating anything in namespaces being deleted
+		if !namespace.DeletionTimestamp.IsZero() {
+			continue
+		}
+		selected[namespace.Name] = true
+		conflict, err := r.applyFQDNNetworkPolicy(ctx, clusterPolicy, namespace.Name)
+		if err != nil {
+			log.Error(err, "unable to apply FQDNNetworkPolicy", "namespace", namespace.Name)
+			failed = append(failed, namespace.Name)
+			errs = append(errs, fmt.Errorf("namespace %s: %w", namespace.Name, err))
+			continue
+		}
+		if conflict {
+			conflicts = append(conflicts, namespace.Name)
+			continue
+		}
+		applied = append(applied, namespace.Name)
+	}
+
+	// Cleaning up the namespaces not selected anymore
+	for i := range owned.Items {
+		policy := &owned.Items[i]
+		if selected[policy.Namespace] {
+			continue
+		}
+		log.Info("namespace not selected anymore, deleting its FQDNNetworkPolicy", "namespace", policy.Namespace)
+		if err := r.Delete(ctx, policy); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to delete FQDNNetworkPolicy", "namespace", policy.Namespace)
+			failed = append(failed, policy.Namespace)
+			errs = append(errs, fmt.Errorf("namespace %s: %w", policy.Namespace, err))
+		}
+	}
+
+	sort.Strings(applied)
+	clusterPolicy.Status.Namespaces = applied
+	clusterPolicy.Status.ObservedGeneration = clusterPolicy.Generation
+	switch {
+	case len(failed) > 0:
+		sort.Strings(failed)
+		r.setReadyCondition(clusterPolicy, metav1.ConditionFalse, "SyncFailed",
+			"Unable to sync the FQDNNetworkPolicies in namespaces "+strings.Join(failed, ", "))
+	case len(conflicts) > 0:
+		sort.Strings(conflicts)
+		r.setReadyCondition(clusterPolicy, metav1.ConditionFalse, "OwnershipConflict",
+			"FQDNNetworkPolicy exists and isn't owned by this ClusterFQDNNetworkPolicy in namespaces "+
+				strings.Join(conflicts, ", "))
+	default:
+		r.setReadyCondition(clusterPolicy, metav1.ConditionTrue, "Synced",
+			"FQDNNetworkPolicies are up to date")
+	}
+	if err := r.Status().Update(ctx, clusterPolicy); err != nil {
+		log.Error(err, "unable to update ClusterFQDNNetworkPolicy status")
+		return ctrl.Result{}, err
+	}
+	// Retrying the namespaces that failed to sync
+	return ctrl.Result{}, kerrors.NewAggregate(errs)
+}
+
+// applyFQDNNetworkPolicy creates or updates the FQDNNetworkPolicy of
+// clusterPolicy in namespace. It returns true, without changing anything, if
+// a FQDNNetworkPolicy of the same name that isn't owned by clusterPolicy
+// already exists.
+func (r *ClusterFQDNNetworkPolicyReconciler) applyFQDNNetworkPolicy(ctx context.Context,
+	clusterPolicy *networkingv1alpha3.ClusterFQDNNetworkPolicy, namespace string) (bool, error) {
+	desired := fqdnNetworkPolicyFor(clusterPolicy, namespace)
+	if err := controllerutil.SetControllerReference(clusterPolicy, desired, r.Scheme); err != nil {
+		return false, err
+	}
+
+	existing := &networkingv1alpha3.FQDNNetworkPolicy{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, desired); err != nil {
+			return false, err
+		}
+		r.Recorder.Eventf(clusterPolicy, corev1.EventTypeNormal, "Created",
+			"Created FQDNNetworkPolicy %s/%s", namespace, desired.Name)
+		return false, nil
+	}
+	// As for NetworkPolicies, an existing FQDNNetworkPolicy is only adopted
+	// if it has the cluster-owned-by annotation
+	if existing.Annotations[clusterOwnerAnnotation] != clusterPolicy.Name {
+		r.Recorder.Eventf(clusterPolicy, corev1.EventTypeWarning, "OwnershipConflict",
+			"FQDNNetworkPolicy %s/%s exists and isn't owned by this ClusterFQDNNetworkPolicy", namespace, desired.Name)
+		return true, nil
+	}
+
+	updated := existing.DeepCopy()
+	updated.Spec = desired.Spec
+	for k := range updated.Annotations {
+		if strings.HasPrefix(k, annotationPrefix) {
+			delete(updated.Annotations, k)
+		}
+	}
+	for k, v := range desired.Annotations {
+		updated.Annotations[k] = v
+	}
+	if err := controllerutil.SetControllerReference(clusterPolicy, updated, r.Scheme); err != nil {
+		return false, err
+	}
+	if equality.Semantic.DeepEqual(existing, updated) {
+		return false, nil
+	}
+	return false, r.Update(ctx, updated)
+}
+
+// fqdnNetworkPolicyFor returns the FQDNNetworkPolicy of clusterPolicy in
+// namespace, with its spec and the annotations configuring the controller
+func fqdnNetworkPolicyFor(clusterPolicy *networkingv1alpha3.ClusterFQDNNetworkPolicy,
+	namespace string) *networkingv1alpha3.FQDNNetworkPolicy {
+	annotations := map[string]string{}
+	for k, v := range clusterPolicy.Annotations {
+		if strings.HasPrefix(k, annotationPrefix) {
+			annotations[k] = v
+		}
+	}
+	annotations[clusterOwnerAnnotation] = clusterPolicy.Name
+	return &networkingv1alpha3.FQDNNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        clusterPolicy.Name,
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+		Spec: *clusterPolicy.Spec.FQDNNetworkPolicySpec.DeepCopy(),
+	}
+}
+
+// setReadyCondition sets the Ready condition of the ClusterFQDNNetworkPolicy
+func (r *ClusterFQDNNetworkPolicyReconciler) setReadyCondition(clusterPolicy *networkingv1alpha3.ClusterFQDNNetworkPolicy,
+	status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&clusterPolicy.Status.Conditions, metav1.Condition{
+		Type:               networkingv1alpha3.ReadyCondition,
+		Status:             status,
+		ObservedGeneration: clusterPolicy.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterFQDNNetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("clusterfqdnnetworkpolicy-controller")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1alpha3.FQDNNetworkPolicy{},
+		clusterOwnerKey, func(o client.Object) []string {
+			owner := metav1.GetControllerOf(o)
+			if owner == nil || owner.APIVersion != networkingv1alpha3.GroupVersion.String() ||
+				owner.Kind != "ClusterFQDNNetworkPolicy" {
+				return nil
+			}
+			return []string{owner.Name}
+		}); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&networkingv1alpha3.ClusterFQDNNetworkPolicy{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		// Restoring the FQDNNetworkPolicies changed or deleted by someone
+		// else, ignoring the updates of their status
+		Owns(&networkingv1alpha3.FQDNNetworkPolicy{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		// Namespaces may start or stop matching the namespace selectors when
+		// they are created, deleted or relabelled
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.namespaceRequests),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Complete(r)
+}
+
+// namespaceRequests returns a request for every ClusterFQDNNetworkPolicy, as
+// a namespace may have started or stopped matching any of them
+func (r *ClusterFQDNNetworkPolicyReconciler) namespaceRequests(ctx context.Context, _ client.Object) []reconcile.Request {
+	clusterPolicies := &networkingv1alpha3.ClusterFQDNNetworkPolicyList{}
+	if err := r.List(ctx, clusterPolicies); err != nil {
+		r.Log.Error(err, "unable to list ClusterFQDNNetworkPolicies")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(clusterPolicies.Items))
+	for _, clusterPolicy := range clusterPolicies.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&clusterPolicy)})
+	}
+	return requests
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClusterFQDNNetworkPolicy controller", func() {
+	SetDefaultEventuallyTimeout(TIMEOUT)
+	SetDefaultEventuallyPollingInterval(POLLINTERVAL)
+
+	Describe("Creating a ClusterFQDNNetworkPolicy", func() {
+		Context("when a namespace matches its namespace selector", func() {
+			ctx := context.Background()
+			clusterPolicy := networkingv1alpha3.ClusterFQDNNetworkPolicy{}
+			clusterPolicy.GetValidResource()
+			clusterPolicy.Name = "cluster1"
+			namespace := v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "cluster1-selected",
+				Labels: map[string]string{"egress": "github"},
+			}}
+			nn := types.NamespacedName{Namespace: namespace.Name, Name: clusterPolicy.Name}
+			It("Should create a FQDNNetworkPolicy and its NetworkPolicy in the namespace", func() {
+				Expect(k8sClient.Create(ctx, &namespace)).Should(Succeed())
+				Expect(k8sClient.Create(ctx, &clusterPolicy)).Should(Succeed())
+				Eventually(func() error {
+					fqdnNetworkPolicy := networkingv1alpha3.FQDNNetworkPolicy{}
+					if err := k8sClient.Get(ctx, nn, &fqdnNetworkPolicy); err != nil {
+						return err
+					}
+					if !metav1.IsControlledBy(&fqdnNetworkPolicy, &clusterPolicy) {
+						return errors.New("FQDNNetworkPolicy isn't controlled by the ClusterFQDNNetworkPolicy")
+					}
+					return k8sClient.Get(ctx, nn, &networking.NetworkPolicy{})
+				}).Should(Succeed())
+				Eventually(func() error {
+					c := networkingv1alpha3.ClusterFQDNNetworkPolicy{}
+					if err := k8sClient.Get(ctx, types.NamespacedName{Name: clusterPolicy.Name}, &c); err != nil {
+						return err
+					}
+					if !meta.IsStatusConditionTrue(c.Status.Conditions, networkingv1alpha3.ReadyCondition) ||
+						!containsString(c.Status.Namespaces, namespace.Name) {
+						return errors.New("unexpected status: " + fmt.Sprint(c.Status))
+					}
+					return nil
+				}).Should(Succeed())
+			})
+			It("Should delete the FQDNNetworkPolicy when the namespace stops matching", func() {
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: namespace.Name}, &namespace)).Should(Succeed())
+				namespace.Labels["egress"] = "none"
+				Expect(k8sClient.Update(ctx, &namespace)).Should(Succeed())
+				Eventually(func() error {
+					return k8sClient.Get(ctx, nn, &networkingv1alpha3.FQDNNetworkPolicy{})
+				}).ShouldNot(Succeed())
+				Expect(k8sClient.Delete(ctx, &clusterPolicy)).Should(Succeed())
+			})
+		})
+	})
+})
+
+func TestFQDNNetworkPolicyFor(t *testing.T) {
+	clusterPolicy := networkingv1alpha3.ClusterFQDNNetworkPolicy{}
+	clusterPolicy.GetValidResource()
+	clusterPolicy.Annotations = map[string]string{
+		aaaaLookupsAnnotation: "skip",
+		"example.com/other":   "not copied",
+	}
+
+	policy := fqdnNetworkPolicyFor(&clusterPolicy, "team-a")
+	if policy.Name != clusterPolicy.Name || policy.Namespace != "team-a" {
+		t.Errorf("unexpected FQDNNetworkPolicy %s/%s", policy.Namespace, policy.Name)
+	}
+	expected := map[string]string{
+		aaaaLookupsAnnotation:  "skip",
+		clusterOwnerAnnotation: clusterPolicy.Name,
+	}
+	if !equality.Semantic.DeepEqual(policy.Annotations, expected) {
+		t.Errorf("expected the annotations %v, got %v", expected, policy.Annotations)
+	}
+	if !equality.Semantic.DeepEqual(policy.Spec, clusterPolicy.Spec.FQDNNetworkPolicySpec) {
+		t.Errorf("unexpected spec %+v", policy.Spec)
+	}
+	// the spec is copied, not shared
+	policy.Spec.Egress[0].To[0].FQDNs[0] = "gitlab.com"
+	if clusterPolicy.Spec.Egress[0].To[0].FQDNs[0] != "github.com" {
+		t.Error("changing the FQDNNetworkPolicy changed the ClusterFQDNNetworkPolicy")
+	}
+}
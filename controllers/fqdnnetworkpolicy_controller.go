@@ -20,18 +20,34 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
 	"github.com/go-logr/logr"
 
 	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 )
 
@@ -40,22 +56,99 @@ type FQDNNetworkPolicyReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Recorder records Events on the FQDNNetworkPolicies. Defaults to the
+	// EventRecorder of the manager.
+	Recorder record.EventRecorder
+	// Resolver is used to resolve the FQDNs of the FQDNNetworkPolicies.
+	// Defaults to a DNSResolver using /etc/resolv.conf.
+	Resolver Resolver
+	// MaxConcurrentReconciles is the maximum number of FQDNNetworkPolicies
+	// reconciled at the same time. Defaults to 1.
+	MaxConcurrentReconciles int
+	// MaxConcurrentQueries is the maximum number of DNS queries in flight
+	// for a single FQDNNetworkPolicy. Defaults to 10.
+	MaxConcurrentQueries int
+	// QueryTimeout is how long to wait for a single FQDN and record type
+	// to be resolved. Defaults to 0, leaving it to the Resolver: the
+	// DNSResolver waits up to timeout × attempts × nameservers of its
+	// resolv.conf for each name it tries.
+	QueryTimeout time.Duration
+	// MinTTL is the lowest time between two resolutions of a FQDN, even if
+	// the TTL of its records is lower. Defaults to 5 seconds.
+	MinTTL time.Duration
+	// MaxTTL is the highest time between two resolutions of a FQDN, even if
+	// the TTL of its records is higher. Defaults to 30 seconds.
+	MaxTTL time.Duration
+	// RetryInterval is how long to wait before reconciling a
+	// FQDNNetworkPolicy again after an error. Defaults to 10 seconds.
+	// It doubles on each consecutive error, up to MaxRetryInterval.
+	RetryInterval time.Duration
+	// MaxRetryInterval is the highest time to wait before reconciling a
+	// FQDNNetworkPolicy again after consecutive errors. Defaults to 5 minutes.
+	MaxRetryInterval time.Duration
+	// IPRetention is how long the addresses of a FQDN are kept in the
+	// NetworkPolicy after they stopped being resolved. Defaults to 0,
+	// removing them right away.
+	IPRetention time.Duration
+	// FailurePolicy is what happens to the addresses of a FQDN that can't be
+	// resolved anymore, because of a timeout or a SERVFAIL for example: with
+	// FailClosed they are removed from the NetworkPolicy, with
+	// KeepLastKnownGood they are kept until MaxStaleness is reached.
+	// Defaults to FailClosed.
+	FailurePolicy string
+	// MaxStaleness is how long the last known addresses of a FQDN are kept
+	// after it stopped resolving, with the KeepLastKnownGood failure policy.
+	// Defaults to 1 hour.
+	MaxStaleness time.Duration
+	// MaxPrefixWidening is how many bits shorter than a single address the
+	// CIDRs of the NetworkPolicies can be when merging adjacent addresses.
+	// Defaults to 0, only removing the duplicate addresses.
+	MaxPrefixWidening int
+	// Hostnames provides the hostnames matching the wildcard FQDNs, on top
+	// of the ones listed in the status of the FQDNNetworkPolicies. Optional.
+	Hostnames HostnameSource
+
+	// scheduler resolves the FQDNs again when their TTL expires, and
+	// triggers the reconciliation of the FQDNNetworkPolicies using them
+	// if their addresses changed.
+	scheduler *fqdnScheduler
 }
 
 var (
-	ownerAnnotation        = "fqdnnetworkpolicies.networking.gke.io/owned-by"
-	deletePolicyAnnotation = "fqdnnetworkpolicies.networking.gke.io/delete-policy"
-	aaaaLookupsAnnotation  = "fqdnnetworkpolicies.networking.gke.io/aaaa-lookups"
-	finalizerName          = "finalizer.fqdnnetworkpolicies.networking.gke.io"
-	// TODO make retry configurable
-	retry = time.Second * time.Duration(10)
+	ownerAnnotation          = "fqdnnetworkpolicies.networking.gke.io/owned-by"
+	deletePolicyAnnotation   = networkingv1alpha3.DeletePolicyAnnotation
+	aaaaLookupsAnnotation    = networkingv1alpha3.AAAALookupsAnnotation
+	minTTLAnnotation         = "fqdnnetworkpolicies.networking.gke.io/min-ttl"
+	maxTTLAnnotation         = "fqdnnetworkpolicies.networking.gke.io/max-ttl"
+	retryAnnotation          = "fqdnnetworkpolicies.networking.gke.io/retry-interval"
+	ipRetentionAnnotation    = "fqdnnetworkpolicies.networking.gke.io/ip-retention"
+	failurePolicyAnnotation  = "fqdnnetworkpolicies.networking.gke.io/failure-policy"
+	maxStalenessAnnotation   = "fqdnnetworkpolicies.networking.gke.io/max-staleness"
+	prefixWideningAnnotation = "fqdnnetworkpolicies.networking.gke.io/max-prefix-widening"
+	finalizerName            = "finalizer.fqdnnetworkpolicies.networking.gke.io"
+	// fieldManager is the name of the controller in the managedFields of the
+	// NetworkPolicies it applies
+	fieldManager = "fqdnnetworkpolicy-controller"
+)
+
+// The failure policies, deciding what happens to the addresses of the FQDNs
+// that stop resolving
+const (
+	// FailClosed removes the addresses of a FQDN from the NetworkPolicy as
+	// soon as it can't be resolved
+	FailClosed = "fail-closed"
+	// KeepLastKnownGood keeps the last addresses a FQDN resolved to in the
+	// NetworkPolicy while it can't be resolved, up to a maximum staleness
+	KeepLastKnownGood = "keep-last-known-good"
 )
 
 //+kubebuilder:rbac:groups=networking.gke.io,resources=fqdnnetworkpolicies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.gke.io,resources=fqdnnetworkpolicies/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=networking.gke.io,resources=fqdnnetworkpolicies/finalizers,verbs=update
+//+kubebuilder:rbac:groups=networking.gke.io,resources=fqdnsets;clusterfqdnsets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -81,6 +174,8 @@ func (r *FQDNNetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Re
 			// we'll ignore not-found errors, since they can't be fixed by an immediate
 			// requeue (we'll need to wait for a new notification), and we can get them
 			// on deleted requests.
+			r.scheduler.forget(req.NamespacedName)
+			deletePolicyMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "unable to fetch FQDNNetworkPolicy")
@@ -120,26 +215,60 @@ func (r *FQDNNetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		}
 
 		// Stop reconciliation as the item is being deleted
+		r.scheduler.forget(req.NamespacedName)
+		deletePolicyMetrics(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
+	// The intervals between syncs may be overridden by annotations
+	intervals, err := r.syncIntervals(fqdnNetworkPolicy)
 	// Updating the NetworkPolicy associated with our FQDNNetworkPolicy
-	// nextSyncIn represents when we should check in again on that FQDNNetworkPolicy.
-	// It's probably related to the TTL of the DNS records.
-	nextSyncIn, err := r.updateNetworkPolicy(ctx, fqdnNetworkPolicy)
+	// nextSyncIn represents when the FQDNs of that FQDNNetworkPolicy will
+	// be resolved again by the scheduler, based on the TTL of the DNS records.
+	// requeueIn represents when the first address retained in the NetworkPolicy
+	// needs to be removed from it.
+	var nextSyncIn *time.Duration
+	var requeueIn time.Duration
+	// The Resolved condition is set again when the FQDNs are resolved
+	var previousResolved *metav1.Condition
+	if c := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition); c != nil {
+		previous := *c
+		previousResolved = &previous
+		meta.RemoveStatusCondition(&fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition)
+	}
+	if err == nil {
+		// The FQDNs of the referenced sets are resolved like the FQDNs of
+		// the peers. The spec isn't written back.
+		err = r.expandFQDNSets(ctx, fqdnNetworkPolicy)
+	}
+	if err == nil {
+		nextSyncIn, requeueIn, err = r.updateNetworkPolicy(ctx, fqdnNetworkPolicy, intervals)
+	}
 	if err != nil {
 		log.Error(err, "unable to update NetworkPolicy")
 		fqdnNetworkPolicy.Status.State = networkingv1alpha3.PendingState
 		fqdnNetworkPolicy.Status.Reason = err.Error()
-		n := metav1.NewTime(time.Now().Add(retry))
+		fqdnNetworkPolicy.Status.ObservedGeneration = fqdnNetworkPolicy.Generation
+		setSyncFailedConditions(fqdnNetworkPolicy, previousResolved, err)
+		r.scheduler.syncFailed(req.NamespacedName)
+		// Backing off exponentially so that broken FQDNNetworkPolicies
+		// don't hammer the API server and the nameservers
+		fqdnNetworkPolicy.Status.Attempts++
+		retryIn := backoff(intervals.retry, r.MaxRetryInterval, fqdnNetworkPolicy.Status.Attempts)
+		n := metav1.NewTime(time.Now().Add(retryIn))
 		fqdnNetworkPolicy.Status.NextSyncTime = &n
 		if e := r.Status().Update(ctx, fqdnNetworkPolicy); e != nil {
 			log.Error(e, "unable to update FQDNNetworkPolicy status")
 			return ctrl.Result{}, e
 		}
-		return ctrl.Result{RequeueAfter: retry}, nil
+		setPolicyStateMetric(req.NamespacedName, fqdnNetworkPolicy.Status.State)
+		log.Info("retrying in "+fmt.Sprint(retryIn), "attempts", fqdnNetworkPolicy.Status.Attempts)
+		return ctrl.Result{RequeueAfter: retryIn}, nil
 	}
 	log.Info("NetworkPolicy updated, next sync in " + fmt.Sprint(nextSyncIn))
+	// The status of the FQDNs, and whether they all resolved, has been
+	// computed while resolving them
+	computed := fqdnNetworkPolicy.Status.DeepCopy()
 
 	// Need to fetch the object again before updating it
 	// as its status may have changed since the first time
@@ -153,43 +282,111 @@ func (r *FQDNNetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	}
 
 	fqdnNetworkPolicy.Status.State = networkingv1alpha3.ActiveState
-	nextSyncTime := metav1.NewTime(time.Now().Add(*nextSyncIn))
+	fqdnNetworkPolicy.Status.Reason = ""
+	fqdnNetworkPolicy.Status.Attempts = 0
+	fqdnNetworkPolicy.Status.FQDNs = computed.FQDNs
+	fqdnNetworkPolicy.Status.OmittedFQDNs = computed.OmittedFQDNs
+	fqdnNetworkPolicy.Status.ObservedGeneration = fqdnNetworkPolicy.Generation
+	lastSyncTime := metav1.Now()
+	fqdnNetworkPolicy.Status.LastSyncTime = &lastSyncTime
+	nextSyncTime := metav1.NewTime(lastSyncTime.Add(*nextSyncIn))
 	fqdnNetworkPolicy.Status.NextSyncTime = &nextSyncTime
+	restoreConditions(fqdnNetworkPolicy, computed, networkingv1alpha3.ResolvedCondition, networkingv1alpha3.DegradedCondition)
+	setCondition(fqdnNetworkPolicy, networkingv1alpha3.NetworkPolicySyncedCondition,
+		metav1.ConditionTrue, "Synced", "NetworkPolicy is up to date")
+	setCondition(fqdnNetworkPolicy, networkingv1alpha3.ReadyCondition,
+		metav1.ConditionTrue, "Synced", "NetworkPolicy is up to date")
 
 	// Updating the status of our FQDNNetworkPolicy
 	if err := r.Status().Update(ctx, fqdnNetworkPolicy); err != nil {
 		log.Error(err, "unable to update FQDNNetworkPolicy status")
+		r.scheduler.syncFailed(req.NamespacedName)
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{RequeueAfter: *nextSyncIn}, nil
+	setPolicyStateMetric(req.NamespacedName, fqdnNetworkPolicy.Status.State)
+	policyLastSync.WithLabelValues(req.Namespace, req.Name).Set(float64(lastSyncTime.Unix()))
+
+	// No need to requeue, the scheduler triggers a new reconciliation
+	// when the addresses of the FQDNs change, unless some addresses
+	// are retained and need to be removed later on.
+	return ctrl.Result{RequeueAfter: requeueIn}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *FQDNNetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	mgr.GetFieldIndexer()
+	if r.Resolver == nil {
+		r.Resolver = &DNSResolver{}
+	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("fqdnnetworkpolicy-controller")
+	}
+	if r.MaxConcurrentQueries <= 0 {
+		r.MaxConcurrentQueries = 10
+	}
+	if r.MinTTL <= 0 {
+		r.MinTTL = 5 * time.Second
+	}
+	if r.MaxTTL <= 0 {
+		r.MaxTTL = 30 * time.Second
+	}
+	if r.RetryInterval <= 0 {
+		r.RetryInterval = 10 * time.Second
+	}
+	if r.MaxRetryInterval <= 0 {
+		r.MaxRetryInterval = 5 * time.Minute
+	}
+	if r.FailurePolicy == "" {
+		r.FailurePolicy = FailClosed
+	}
+	if r.FailurePolicy != FailClosed && r.FailurePolicy != KeepLastKnownGood {
+		return fmt.Errorf("invalid failure policy %q, expecting %s or %s", r.FailurePolicy, FailClosed, KeepLastKnownGood)
+	}
+	if r.MaxStaleness <= 0 {
+		r.MaxStaleness = time.Hour
+	}
+	r.scheduler = newFQDNScheduler(r.Resolver, r.Log.WithName("scheduler"), r.MaxConcurrentQueries, r.QueryTimeout)
+	if err := mgr.Add(r.scheduler); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1alpha3.FQDNNetworkPolicy{},
+		fqdnSetRefKey, fqdnSetRefs); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&networkingv1alpha3.FQDNNetworkPolicy{}).
+		// The status updates don't need to trigger a reconciliation, only the
+		// changes to the spec, to the annotations configuring the controller,
+		// and to the wildcard hostnames listed in the status
+		For(&networkingv1alpha3.FQDNNetworkPolicy{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{},
+				wildcardHostnamesChangedPredicate()))).
+		// Reconciling right away when someone changes or deletes a NetworkPolicy
+		Owns(&networking.NetworkPolicy{}).
+		WatchesRawSource(&source.Channel{Source: r.scheduler.events}, &handler.EnqueueRequestForObject{}).
+		// Updating the FQDNNetworkPolicies referencing a set when it changes
+		Watches(&networkingv1alpha3.FQDNSet{}, handler.EnqueueRequestsFromMapFunc(r.fqdnSetRequests)).
+		Watches(&networkingv1alpha3.ClusterFQDNSet{}, handler.EnqueueRequestsFromMapFunc(r.fqdnSetRequests)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
 func (r *FQDNNetworkPolicyReconciler) updateNetworkPolicy(ctx context.Context,
-	fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) (*time.Duration, error) {
+	fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy, intervals syncIntervals) (*time.Duration, time.Duration, error) {
 	log := r.Log.WithValues("fqdnnetworkpolicy", fqdnNetworkPolicy.Namespace+"/"+fqdnNetworkPolicy.Name)
 	toCreate := false
 
 	// Trying to fetch an existing NetworkPolicy of the same name as our FQDNNetworkPolicy
-	networkPolicy := &networking.NetworkPolicy{}
+	existing := &networking.NetworkPolicy{}
 	if err := r.Get(ctx, client.ObjectKey{
 		Namespace: fqdnNetworkPolicy.Namespace,
 		Name:      fqdnNetworkPolicy.Name,
-	}, networkPolicy); err != nil {
+	}, existing); err != nil {
 		if client.IgnoreNotFound(err) == nil {
 			// If there is none, that's OK, it means that we just haven't created it yet
 			log.V(1).Info("associated NetworkPolicy doesn't exist, creating it")
 			toCreate = true
 		} else {
-			return nil, err
+			return nil, 0, err
 		}
 	}
 	if !toCreate {
@@ -200,50 +397,130 @@ func (r *FQDNNetworkPolicyReconciler) updateNetworkPolicy(ctx context.Context,
 	// it means that it was created manually beforehand, and we don't want to touch it.
 	// This also means that you can have a FQDNNetworkPolicy "adopt" a NetworkPolicy of the
 	// same name by adding the correct annotation.
-	if !toCreate && networkPolicy.Annotations[ownerAnnotation] != fqdnNetworkPolicy.Name {
-		return nil, errors.New("NetworkPolicy missing owned-by annotation or owned by a different resource")
+	if !toCreate && existing.Annotations[ownerAnnotation] != fqdnNetworkPolicy.Name {
+		r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeWarning, "OwnershipConflict",
+			"NetworkPolicy "+existing.Name+" exists and isn't owned by this FQDNNetworkPolicy")
+		return nil, 0, errors.New("NetworkPolicy missing owned-by annotation or owned by a different resource")
 	}
 
-	// Updating NetworkPolicy
-	networkPolicy.Name = fqdnNetworkPolicy.Name
-	networkPolicy.Namespace = fqdnNetworkPolicy.Namespace
-	if networkPolicy.Annotations == nil {
-		networkPolicy.Annotations = make(map[string]string)
+	// The NetworkPolicy is applied server-side, so it only holds the fields
+	// managed by the controller. The labels and annotations added by other
+	// tools are left untouched.
+	networkPolicy := &networking.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networking.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fqdnNetworkPolicy.Name,
+			Namespace:   fqdnNetworkPolicy.Namespace,
+			Annotations: map[string]string{ownerAnnotation: fqdnNetworkPolicy.Name},
+		},
+	}
+	// The FQDNNetworkPolicy controls the NetworkPolicy, so that changes to the
+	// NetworkPolicy trigger a reconciliation, and the NetworkPolicy is garbage
+	// collected along with the FQDNNetworkPolicy, unless it's to be abandoned.
+	abandon := abandoned(fqdnNetworkPolicy, existing)
+	if !abandon {
+		if err := controllerutil.SetControllerReference(fqdnNetworkPolicy, networkPolicy, r.Scheme); err != nil {
+			return nil, 0, err
+		}
 	}
-	networkPolicy.Annotations[ownerAnnotation] = fqdnNetworkPolicy.Name
 	networkPolicy.Spec.PodSelector = fqdnNetworkPolicy.Spec.PodSelector
 	networkPolicy.Spec.PolicyTypes = fqdnNetworkPolicy.Spec.PolicyTypes
+	// the status of the FQDNs is filled while resolving them
+	previous := fqdnNetworkPolicy.Status.FQDNs
+	fqdnNetworkPolicy.Status.FQDNs = nil
+	// resolving all the FQDNs of the FQDNNetworkPolicy concurrently
+	answers, resolved := r.resolveFQDNs(ctx, fqdnNetworkPolicy)
+	setResolvedCondition(fqdnNetworkPolicy, answers)
+	// keeping the addresses seen recently, even if not resolved anymore
+	now := metav1.Now()
+	retained, expiry := retainAddresses(&fqdnNetworkPolicy.Status, previous, answers,
+		intervals.retention, now)
+	setResolutionStatus(&fqdnNetworkPolicy.Status, previous, answers, now)
+	r.recordResolutionFailures(fqdnNetworkPolicy, previous)
+	// keeping the last known addresses of the FQDNs that failed to resolve,
+	// depending on the failure policy
+	stale, staleExpiry := keepLastKnownGood(&fqdnNetworkPolicy.Status, previous, retained,
+		intervals.maxStaleness, now)
+	if !staleExpiry.IsZero() && (expiry.IsZero() || staleExpiry.Before(expiry)) {
+		expiry = staleExpiry
+	}
+	r.setDegradedCondition(fqdnNetworkPolicy, stale)
+	// the duplicate addresses are removed, and the adjacent ones may be
+	// merged, to keep the NetworkPolicy small
+	maxWidening, err := r.maxPrefixWidening(fqdnNetworkPolicy)
+	if err != nil {
+		return nil, 0, err
+	}
 	// egress rules
-	egressRules, nextSync, err := r.getNetworkPolicyEgressRules(ctx, fqdnNetworkPolicy)
+	egressRules, nextSync, err := r.getNetworkPolicyEgressRules(ctx, fqdnNetworkPolicy, retained, intervals, maxWidening)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	networkPolicy.Spec.Egress = egressRules
 	// ingress rules
-	ingressRules, ingressNextSync, err := r.getNetworkPolicyIngressRules(ctx, fqdnNetworkPolicy)
+	ingressRules, ingressNextSync, err := r.getNetworkPolicyIngressRules(ctx, fqdnNetworkPolicy, retained, intervals, maxWidening)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	// We sync just after the shortest TTL between ingress and egress rules
 	networkPolicy.Spec.Ingress = ingressRules
 	if ingressNextSync.Milliseconds() < nextSync.Milliseconds() {
 		nextSync = ingressNextSync
 	}
+	// but not before the minimum TTL
+	*nextSync = intervals.clamp(*nextSync)
+	// keeping the status of the FQDNs small enough for large FQDNNetworkPolicies
+	boundStatus(&fqdnNetworkPolicy.Status)
 
-	// creating NetworkPolicy if needed
-	if toCreate {
-		if err := r.Create(ctx, networkPolicy); err != nil {
-			log.Error(err, "unable to create NetworkPolicy")
-			return nil, err
+	if !toCreate && equalNetworkPolicySpecs(&existing.Spec, &networkPolicy.Spec) &&
+		metav1.IsControlledBy(existing, fqdnNetworkPolicy) == !abandon {
+		// Not writing the NetworkPolicy if nothing changed, as every write
+		// wakes up the CNI agents watching NetworkPolicies.
+		log.V(1).Info("NetworkPolicy is up to date, not updating it")
+	} else {
+		// Creating or updating the NetworkPolicy. We force the ownership of
+		// the fields we manage, in case someone else changed them.
+		err := r.Patch(ctx, networkPolicy, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+		countNetworkPolicyWrite("apply", err)
+		if err != nil {
+			log.Error(err, "unable to apply NetworkPolicy")
+			return nil, 0, err
 		}
 	}
-	// Updating the NetworkPolicy
-	if err := r.Update(ctx, networkPolicy); err != nil {
-		log.Error(err, "unable to update NetworkPolicy")
-		return nil, err
+	cidrs := networkPolicyCIDRs(networkPolicy)
+	policyAddresses.WithLabelValues(fqdnNetworkPolicy.Namespace, fqdnNetworkPolicy.Name).Set(float64(len(cidrs)))
+	added, removed := diffCIDRs(networkPolicyCIDRs(existing), cidrs)
+	if toCreate {
+		r.Recorder.Eventf(fqdnNetworkPolicy, corev1.EventTypeNormal, "Created",
+			"Created NetworkPolicy %s with %d CIDRs", networkPolicy.Name, added)
+	} else if added > 0 || removed > 0 {
+		r.Recorder.Eventf(fqdnNetworkPolicy, corev1.EventTypeNormal, "Updated",
+			"Updated NetworkPolicy %s: %d CIDRs added, %d removed", networkPolicy.Name, added, removed)
+	}
+
+	// The FQDNs will be resolved again when their TTL expires
+	r.scheduler.track(client.ObjectKeyFromObject(fqdnNetworkPolicy), resolved, intervals)
+
+	var requeueIn time.Duration
+	if !expiry.IsZero() {
+		requeueIn = intervals.clamp(time.Until(expiry))
 	}
+	if len(resolved) != len(answers) && (requeueIn == 0 || requeueIn > intervals.maxTTL) {
+		// New hostnames may match the wildcard FQDNs by then
+		requeueIn = intervals.maxTTL
+	}
+	return nextSync, requeueIn, nil
+}
 
-	return nextSync, nil
+// abandoned returns whether the NetworkPolicy is to be kept when the
+// FQDNNetworkPolicy is deleted, as set by the delete-policy annotation of
+// either of them
+func abandoned(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy, networkPolicy *networking.NetworkPolicy) bool {
+	return fqdnNetworkPolicy.Annotations[deletePolicyAnnotation] == "abandon" ||
+		networkPolicy.Annotations[deletePolicyAnnotation] == "abandon"
 }
 
 // deleteNetworkPolicy deletes the NetworkPolicy associated with the fqdnNetworkPolicy FQDNNetworkPolicy
@@ -264,122 +541,64 @@ func (r *FQDNNetworkPolicyReconciler) deleteNetworkPolicy(ctx context.Context,
 		}
 		return err
 	}
-	if networkPolicy.Annotations[deletePolicyAnnotation] == "abandon" {
+	if abandoned(fqdnNetworkPolicy, networkPolicy) {
+		// Removing our owner reference, if still there, so that the garbage
+		// collector doesn't delete the NetworkPolicy
+		if refs := removeOwnerReference(networkPolicy.OwnerReferences, fqdnNetworkPolicy); len(refs) != len(networkPolicy.OwnerReferences) {
+			networkPolicy.OwnerReferences = refs
+			err := r.Update(ctx, networkPolicy)
+			countNetworkPolicyWrite("update", err)
+			if err != nil {
+				log.Error(err, "unable to remove the owner reference from the NetworkPolicy")
+				return err
+			}
+		}
 		log.Info("NetworkPolicy has delete policy set to abandon, not deleting")
+		r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeNormal, "Abandoned",
+			"NetworkPolicy "+networkPolicy.Name+" has delete policy set to abandon, not deleting")
 		return nil
 	}
 	if networkPolicy.Annotations[ownerAnnotation] != fqdnNetworkPolicy.Name {
 		log.Info("NetworkPolicy is not owned by FQDNNetworkPolicy, not deleting")
 		return nil
 	}
-	if err := r.Delete(ctx, networkPolicy); err != nil {
+	if metav1.IsControlledBy(networkPolicy, fqdnNetworkPolicy) {
+		// The garbage collector deletes the NetworkPolicy once the
+		// FQDNNetworkPolicy is gone
+		log.Info("NetworkPolicy will be garbage collected")
+		r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeNormal, "Deleted",
+			"NetworkPolicy "+networkPolicy.Name+" will be garbage collected")
+		return nil
+	}
+	// The NetworkPolicies created by older versions of the controller
+	// don't have an owner reference
+	err := r.Delete(ctx, networkPolicy)
+	countNetworkPolicyWrite("delete", err)
+	if err != nil {
 		log.Error(err, "unable to delete the NetworkPolicy")
 		return err
 	}
 	log.Info("NetworkPolicy deleted")
+	r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeNormal, "Deleted", "Deleted NetworkPolicy "+networkPolicy.Name)
 	return nil
 }
 
 // getNetworkPolicyIngressRules returns a slice of NetworkPolicyIngressRules based on the
 // provided slice of FQDNNetworkPolicyIngressRules, also returns when the next sync should happen
 // based on the TTL of records
-func (r *FQDNNetworkPolicyReconciler) getNetworkPolicyIngressRules(ctx context.Context, fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) ([]networking.NetworkPolicyIngressRule, *time.Duration, error) {
+func (r *FQDNNetworkPolicyReconciler) getNetworkPolicyIngressRules(ctx context.Context, fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	answers map[query]result, intervals syncIntervals, maxWidening int) ([]networking.NetworkPolicyIngressRule, *time.Duration, error) {
 	log := r.Log.WithValues("fqdnnetworkpolicy", fqdnNetworkPolicy.Namespace+"/"+fqdnNetworkPolicy.Name)
 	fir := fqdnNetworkPolicy.Spec.Ingress
 	rules := []networking.NetworkPolicyIngressRule{}
 
-	// getting the nameservers from the local /etc/resolv.conf
-	ns, err := getNameservers()
-	if err != nil {
-		log.Error(err, "unable to get nameservers")
-		return nil, nil, err
-	}
-	var nextSync uint32
 	// Highest value possible for the resync time on the FQDNNetworkPolicy
-	// TODO what should this be?
-	nextSync = 30
+	nextSync := intervals.maxTTLSeconds()
 
 	// TODO what do we do if nothing resolves, or if the list is empty?
 	// What's the behavior of NetworkPolicies in that case?
 	for _, frule := range fir {
-		peers := []networking.NetworkPolicyPeer{}
-		for _, from := range frule.From {
-			for _, fqdn := range from.FQDNs {
-				f := fqdn
-				// The FQDN in the DNS request needs to end by a dot
-				if l := fqdn[len(fqdn)-1]; l != '.' {
-					f = fqdn + "."
-				}
-				c := new(dns.Client)
-				c.SingleInflight = true
-
-				// A records
-				m := new(dns.Msg)
-				m.SetQuestion(f, dns.TypeA)
-
-				// TODO: We're always using the first nameserver. Should we do
-				// something different? Note from Jens:
-				// by default only if options rotate is set in resolv.conf
-				// they are rotated. Otherwise the first is used, after a (5s)
-				// timeout the next etc. So this is not too bad for now.
-				r, _, err := c.Exchange(m, "["+ns[0]+"]:53")
-				if err != nil {
-					log.Error(err, "unable to resolve "+f)
-					continue
-				}
-				if len(r.Answer) == 0 {
-					log.V(1).Info("could not find A record for " + f)
-				}
-				for _, ans := range r.Answer {
-					if t, ok := ans.(*dns.A); ok {
-						// Adding a peer per answer
-						peers = append(peers, networking.NetworkPolicyPeer{
-							IPBlock: &networking.IPBlock{CIDR: t.A.String() + "/32"}})
-						// We want the next sync for the FQDNNetworkPolicy to happen
-						// just after the TTL of the DNS record has expired.
-						// Because a single FQDNNetworkPolicy may have different DNS
-						// records with different TTLs, we pick the lowest one
-						// and resynchronise after that.
-						if ans.Header().Ttl < nextSync {
-							nextSync = ans.Header().Ttl
-						}
-					}
-				}
-
-				// AAAA records
-				m6 := new(dns.Msg)
-				m6.SetQuestion(f, dns.TypeAAAA)
-
-				// TODO: We're always using the first nameserver. Should we do
-				// something different? Note from Jens:
-				// by default only if options rotate is set in resolv.conf
-				// they are rotated. Otherwise the first is used, after a (5s)
-				// timeout the next etc. So this is not too bad for now.
-				r6, _, err := c.Exchange(m6, "["+ns[0]+"]:53")
-				if err != nil {
-					log.Error(err, "unable to resolve "+f)
-					continue
-				}
-				if len(r6.Answer) == 0 {
-					log.V(1).Info("could not find AAAA record for " + f)
-				}
-				for _, ans := range r6.Answer {
-					if t, ok := ans.(*dns.AAAA); ok {
-						// Adding a peer per answer
-						peers = append(peers, networking.NetworkPolicyPeer{
-							IPBlock: &networking.IPBlock{CIDR: t.AAAA.String() + "/128"}})
-						// We want the next sync for the FQDNNetworkPolicy to happen
-						// just after the TTL of the DNS record has expired.
-						// Because a single FQDNNetworkPolicy may have different DNS
-						// records with different TTLs, we pick the lowest one
-						// and resynchronise after that.
-						if ans.Header().Ttl < nextSync {
-							nextSync = ans.Header().Ttl
-						}
-					}
-				}
-			}
-		}
+		peers := getPeers(log, fqdnNetworkPolicy, frule.From, answers, &nextSync, maxWidening)
 
 		if len(peers) == 0 {
 			// If no peers have been found (most likely because the provided
@@ -404,107 +623,19 @@ func (r *FQDNNetworkPolicyReconciler) getNetworkPolicyIngressRules(ctx context.C
 // getNetworkPolicyEgressRules returns a slice of NetworkPolicyEgressRules based on the
 // provided slice of FQDNNetworkPolicyEgressRules, also returns when the next sync should happen
 // based on the TTL of records
-func (r *FQDNNetworkPolicyReconciler) getNetworkPolicyEgressRules(ctx context.Context, fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) ([]networking.NetworkPolicyEgressRule, *time.Duration, error) {
+func (r *FQDNNetworkPolicyReconciler) getNetworkPolicyEgressRules(ctx context.Context, fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	answers map[query]result, intervals syncIntervals, maxWidening int) ([]networking.NetworkPolicyEgressRule, *time.Duration, error) {
 	log := r.Log.WithValues("fqdnnetworkpolicy", fqdnNetworkPolicy.Namespace+"/"+fqdnNetworkPolicy.Name)
 	fer := fqdnNetworkPolicy.Spec.Egress
 	rules := []networking.NetworkPolicyEgressRule{}
 
-	// getting the nameservers from the local /etc/resolv.conf
-	ns, err := getNameservers()
-	if err != nil {
-		log.Error(err, "unable to get nameservers")
-		return nil, nil, err
-	}
-	var nextSync uint32
 	// Highest value possible for the resync time on the FQDNNetworkPolicy
-	// TODO what should this be?
-	nextSync = 30
+	nextSync := intervals.maxTTLSeconds()
 
 	// TODO what do we do if nothing resolves, or if the list is empty?
 	// What's the behavior of NetworkPolicies in that case?
 	for _, frule := range fer {
-		peers := []networking.NetworkPolicyPeer{}
-		for _, to := range frule.To {
-			for _, fqdn := range to.FQDNs {
-				f := fqdn
-				// The FQDN in the DNS request needs to end by a dot
-				if l := fqdn[len(fqdn)-1]; l != '.' {
-					f = fqdn + "."
-				}
-				c := new(dns.Client)
-				c.SingleInflight = true
-
-				// A records
-				m := new(dns.Msg)
-				m.SetQuestion(f, dns.TypeA)
-
-				// TODO: We're always using the first nameserver. Should we do
-				// something different? Note from Jens:
-				// by default only if options rotate is set in resolv.conf
-				// they are rotated. Otherwise the first is used, after a (5s)
-				// timeout the next etc. So this is not too bad for now.
-				r, _, err := c.Exchange(m, "["+ns[0]+"]:53")
-				if err != nil {
-					log.Error(err, "unable to resolve "+f)
-					continue
-				}
-				if len(r.Answer) == 0 {
-					log.V(1).Info("could not find A record for " + f)
-				}
-				for _, ans := range r.Answer {
-					if t, ok := ans.(*dns.A); ok {
-						// Adding a peer per answer
-						peers = append(peers, networking.NetworkPolicyPeer{
-							IPBlock: &networking.IPBlock{CIDR: t.A.String() + "/32"}})
-						// We want the next sync for the FQDNNetworkPolicy to happen
-						// just after the TTL of the DNS record has expired.
-						// Because a single FQDNNetworkPolicy may have different DNS
-						// records with different TTLs, we pick the lowest one
-						// and resynchronise after that.
-						if ans.Header().Ttl < nextSync {
-							nextSync = ans.Header().Ttl
-						}
-					}
-				}
-				// check for AAAA lookups skip annotation
-				if fqdnNetworkPolicy.Annotations[aaaaLookupsAnnotation] == "skip" {
-					log.Info("FQDNNetworkPolicy has AAAA lookups policy set to skip, not resolving AAAA records")
-				} else {
-					// AAAA records
-					m6 := new(dns.Msg)
-					m6.SetQuestion(f, dns.TypeAAAA)
-
-					// TODO: We're always using the first nameserver. Should we do
-					// something different? Note from Jens:
-					// by default only if options rotate is set in resolv.conf
-					// they are rotated. Otherwise the first is used, after a (5s)
-					// timeout the next etc. So this is not too bad for now.
-					r6, _, err := c.Exchange(m6, "["+ns[0]+"]:53")
-					if err != nil {
-						log.Error(err, "unable to resolve "+f)
-						continue
-					}
-					if len(r6.Answer) == 0 {
-						log.V(1).Info("could not find AAAA record for " + f)
-					}
-					for _, ans := range r6.Answer {
-						if t, ok := ans.(*dns.AAAA); ok {
-							// Adding a peer per answer
-							peers = append(peers, networking.NetworkPolicyPeer{
-								IPBlock: &networking.IPBlock{CIDR: t.AAAA.String() + "/128"}})
-							// We want the next sync for the FQDNNetworkPolicy to happen
-							// just after the TTL of the DNS record has expired.
-							// Because a single FQDNNetworkPolicy may have different DNS
-							// records with different TTLs, we pick the lowest one
-							// and resynchronise after that.
-							if ans.Header().Ttl < nextSync {
-								nextSync = ans.Header().Ttl
-							}
-						}
-					}
-				}
-			}
-		}
+		peers := getPeers(log, fqdnNetworkPolicy, frule.To, answers, &nextSync, maxWidening)
 
 		if len(peers) == 0 {
 			// If no peers have been found (most likely because the provided
@@ -525,3 +656,745 @@ func (r *FQDNNetworkPolicyReconciler) getNetworkPolicyEgressRules(ctx context.Co
 
 	return rules, &n, nil
 }
+
+// syncIntervals returns the intervals between syncs of the FQDNNetworkPolicy,
+// as configured on the reconciler unless overridden by annotations.
+func (r *FQDNNetworkPolicyReconciler) syncIntervals(
+	fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) (syncIntervals, error) {
+	defaults := syncIntervals{minTTL: r.MinTTL, maxTTL: r.MaxTTL, retry: r.RetryInterval, retention: r.IPRetention}
+	if r.FailurePolicy == KeepLastKnownGood {
+		defaults.maxStaleness = r.MaxStaleness
+	}
+	intervals := defaults
+	for annotation, d := range map[string]*time.Duration{
+		minTTLAnnotation:      &intervals.minTTL,
+		maxTTLAnnotation:      &intervals.maxTTL,
+		retryAnnotation:       &intervals.retry,
+		ipRetentionAnnotation: &intervals.retention,
+	} {
+		v, ok := fqdnNetworkPolicy.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		// only the retention can be 0, to disable it
+		if err != nil || parsed < 0 || (parsed == 0 && annotation != ipRetentionAnnotation) {
+			// Falling back to the defaults so that we can still retry
+			return defaults,
+				fmt.Errorf("invalid value %q for annotation %s, expecting a positive duration such as 30s", v, annotation)
+		}
+		*d = parsed
+	}
+	if intervals.minTTL > intervals.maxTTL {
+		return defaults,
+			fmt.Errorf("minimum TTL %s is higher than maximum TTL %s", intervals.minTTL, intervals.maxTTL)
+	}
+	policy, ok := fqdnNetworkPolicy.Annotations[failurePolicyAnnotation]
+	if !ok {
+		policy = r.FailurePolicy
+	}
+	switch policy {
+	case "", FailClosed:
+		intervals.maxStaleness = 0
+	case KeepLastKnownGood:
+		intervals.maxStaleness = r.MaxStaleness
+		if v, ok := fqdnNetworkPolicy.Annotations[maxStalenessAnnotation]; ok {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return defaults,
+					fmt.Errorf("invalid value %q for annotation %s, expecting a positive duration such as 30s", v, maxStalenessAnnotation)
+			}
+			intervals.maxStaleness = parsed
+		}
+	default:
+		return defaults, fmt.Errorf("invalid value %q for annotation %s, expecting %s or %s",
+			policy, failurePolicyAnnotation, FailClosed, KeepLastKnownGood)
+	}
+	return intervals, nil
+}
+
+// maxPrefixWidening returns how many bits the CIDRs of the NetworkPolicy can
+// be widened by to merge adjacent addresses, as configured on the reconciler
+// unless overridden by an annotation.
+func (r *FQDNNetworkPolicyReconciler) maxPrefixWidening(
+	fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) (int, error) {
+	v, ok := fqdnNetworkPolicy.Annotations[prefixWideningAnnotation]
+	if !ok {
+		return r.MaxPrefixWidening, nil
+	}
+	widening, err := strconv.Atoi(v)
+	if err != nil || widening < 0 || widening > 128 {
+		return 0, fmt.Errorf("invalid value %q for annotation %s, expecting a number of bits between 0 and 128",
+			v, prefixWideningAnnotation)
+	}
+	return widening, nil
+}
+
+// resolveFQDNs resolves all the FQDNs of the FQDNNetworkPolicy, for A
+// and AAAA records, concurrently. It returns the results for the FQDNs of the
+// FQDNNetworkPolicy, and the results for the names actually resolved, which
+// differ for the wildcard FQDNs.
+func (r *FQDNNetworkPolicyReconciler) resolveFQDNs(ctx context.Context,
+	fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) (map[query]result, map[query]result) {
+	log := r.Log.WithValues("fqdnnetworkpolicy", fqdnNetworkPolicy.Namespace+"/"+fqdnNetworkPolicy.Name)
+
+	// check for AAAA lookups skip annotation
+	skipAAAA := fqdnNetworkPolicy.Annotations[aaaaLookupsAnnotation] == "skip"
+	if skipAAAA {
+		log.Info("FQDNNetworkPolicy has AAAA lookups policy set to skip, not resolving AAAA records")
+	}
+
+	queries := []query{}
+	for _, rule := range fqdnNetworkPolicy.Spec.Egress {
+		for _, to := range rule.To {
+			for _, f := range to.FQDNs {
+				queries = append(queries, query{fqdn: f, recordType: dns.TypeA})
+				if !skipAAAA {
+					queries = append(queries, query{fqdn: f, recordType: dns.TypeAAAA})
+				}
+			}
+		}
+	}
+	for _, rule := range fqdnNetworkPolicy.Spec.Ingress {
+		for _, from := range rule.From {
+			for _, f := range from.FQDNs {
+				queries = append(queries,
+					query{fqdn: f, recordType: dns.TypeA},
+					query{fqdn: f, recordType: dns.TypeAAAA})
+			}
+		}
+	}
+
+	// The wildcard FQDNs are resolved through the hostnames matching them
+	wildcards := map[query][]query{}
+	concrete := []query{}
+	for _, q := range queries {
+		if !isWildcard(q.fqdn) {
+			concrete = append(concrete, q)
+			continue
+		}
+		if _, ok := wildcards[q]; ok {
+			continue
+		}
+		hostnames := r.wildcardHostnames(fqdnNetworkPolicy, q.fqdn)
+		getFQDNStatus(&fqdnNetworkPolicy.Status, q.fqdn).Hostnames = hostnames
+		for _, h := range hostnames {
+			wildcards[q] = append(wildcards[q], query{fqdn: dns.Fqdn(h), recordType: q.recordType})
+		}
+		concrete = append(concrete, wildcards[q]...)
+	}
+
+	resolved := resolveAll(ctx, r.Resolver, concrete, r.MaxConcurrentQueries, r.QueryTimeout)
+	if len(wildcards) == 0 {
+		return resolved, resolved
+	}
+	answers := make(map[query]result, len(resolved)+len(wildcards))
+	for q, res := range resolved {
+		answers[q] = res
+	}
+	for q, hostnames := range wildcards {
+		results := []result{}
+		for _, h := range hostnames {
+			results = append(results, resolved[h])
+		}
+		answers[q] = mergeResults(results)
+	}
+	return answers, resolved
+}
+
+// wildcardHostnames returns the hostnames matching the wildcard FQDN pattern:
+// the ones listed in the wildcardHostnames status field of the
+// FQDNNetworkPolicy, and the ones provided by the HostnameSource of the
+// reconciler, if any.
+func (r *FQDNNetworkPolicyReconciler) wildcardHostnames(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	pattern string) []string {
+	hostnames := []string{}
+	for _, h := range fqdnNetworkPolicy.Status.WildcardHostnames {
+		h = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(h), "."))
+		if matchWildcard(pattern, h) && !containsString(hostnames, h) {
+			hostnames = append(hostnames, h)
+		}
+	}
+	if r.Hostnames != nil {
+		for _, h := range r.Hostnames.Hostnames(pattern) {
+			if !containsString(hostnames, h) {
+				hostnames = append(hostnames, h)
+			}
+		}
+	}
+	sort.Strings(hostnames)
+	if len(hostnames) > maxWildcardHostnames {
+		hostnames = hostnames[:maxWildcardHostnames]
+	}
+	return hostnames
+}
+
+// mergeResults merges the results of the hostnames matching a wildcard FQDN
+// into a single result, holding the addresses of all of them. It's an error
+// only if all of them failed.
+func mergeResults(results []result) result {
+	merged := &Answer{Outcome: OutcomeNoData}
+	var err error
+	for _, res := range results {
+		if res.err != nil {
+			err = res.err
+			continue
+		}
+		merged.Addresses = append(merged.Addresses, res.answer.Addresses...)
+		if merged.Nameserver == "" {
+			merged.Nameserver = res.answer.Nameserver
+		}
+	}
+	if len(merged.Addresses) > 0 {
+		merged.Outcome = OutcomeSuccess
+	} else if err != nil {
+		return result{err: err}
+	}
+	return result{answer: merged}
+}
+
+// getPeers returns the NetworkPolicyPeers for the IP addresses found for the
+// FQDNs of the provided FQDNNetworkPolicyPeers, aggregated with up to
+// maxWidening bits, followed by their pod selectors and CIDR blocks as is.
+// nextSync is lowered to the lowest TTL of the records found, and the CNAME
+// chains followed are recorded in the status of the FQDNNetworkPolicy.
+func getPeers(log logr.Logger, fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	fqdnPeers []networkingv1alpha3.FQDNNetworkPolicyPeer, answers map[query]result,
+	nextSync *uint32, maxWidening int) []networking.NetworkPolicyPeer {
+	peers := []networking.NetworkPolicyPeer{}
+	static := []networking.NetworkPolicyPeer{}
+	for _, fqdnPeer := range fqdnPeers {
+		if fqdnPeer.PodSelector != nil || fqdnPeer.NamespaceSelector != nil || fqdnPeer.IPBlock != nil {
+			static = append(static, networking.NetworkPolicyPeer{
+				PodSelector:       fqdnPeer.PodSelector,
+				NamespaceSelector: fqdnPeer.NamespaceSelector,
+				IPBlock:           fqdnPeer.IPBlock,
+			})
+		}
+		for _, f := range fqdnPeer.FQDNs {
+			for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				res, ok := answers[query{fqdn: f, recordType: recordType}]
+				if !ok {
+					// this record type was not looked up
+					continue
+				}
+				if res.err != nil {
+					log.Error(res.err, "unable to resolve "+f, "outcome", classify(nil, res.err))
+					continue
+				}
+				if len(res.answer.Addresses) == 0 {
+					log.V(1).Info("could not find "+dns.TypeToString[recordType]+" record for "+f,
+						"outcome", res.answer.Outcome)
+				}
+				suffix := "/32"
+				if recordType == dns.TypeAAAA {
+					suffix = "/128"
+				}
+				peers = append(peers, answerToPeers(res.answer, suffix, nextSync)...)
+				setCNAMEChain(&fqdnNetworkPolicy.Status, f, res.answer)
+			}
+		}
+	}
+	return append(aggregatePeers(peers, maxWidening), static...)
+}
+
+// answerToPeers returns a NetworkPolicyPeer per address of the answer, using
+// the provided prefix length suffix for the CIDR.
+func answerToPeers(answer *Answer, suffix string, nextSync *uint32) []networking.NetworkPolicyPeer {
+	peers := []networking.NetworkPolicyPeer{}
+	for _, address := range answer.Addresses {
+		// Adding a peer per answer
+		peers = append(peers, networking.NetworkPolicyPeer{
+			IPBlock: &networking.IPBlock{CIDR: address.IP.String() + suffix}})
+	}
+	// We want the next sync for the FQDNNetworkPolicy to happen
+	// just after the TTL of the DNS records has expired.
+	// Because a single FQDNNetworkPolicy may have different DNS
+	// records with different TTLs, we pick the lowest one
+	// and resynchronise after that. This includes the TTL of
+	// the CNAME records, as the chain may change too.
+	*nextSync = answer.MinTTL(*nextSync)
+	return peers
+}
+
+// setCNAMEChain records in status the CNAME chain followed to resolve fqdn
+func setCNAMEChain(status *networkingv1alpha3.FQDNNetworkPolicyStatus, fqdn string, answer *Answer) {
+	if len(answer.CNAMEs) == 0 {
+		return
+	}
+	chain := []string{}
+	for _, cname := range answer.CNAMEs {
+		chain = append(chain, cname.Target)
+	}
+	getFQDNStatus(status, fqdn).CNAMEChain = chain
+}
+
+// recordResolutionFailures records a Warning Event for each FQDN that stopped
+// resolving since the previous sync
+func (r *FQDNNetworkPolicyReconciler) recordResolutionFailures(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	previous []networkingv1alpha3.FQDNStatus) {
+	failing := map[string]bool{}
+	for _, p := range previous {
+		if p.LastError != "" {
+			failing[p.FQDN] = true
+		}
+	}
+	for _, f := range fqdnNetworkPolicy.Status.FQDNs {
+		if f.LastError != "" && !failing[f.FQDN] {
+			r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeWarning, "ResolutionFailed",
+				"Unable to resolve "+f.FQDN+": "+f.LastError)
+		}
+	}
+}
+
+// removeOwnerReference returns refs without the references to owner
+func removeOwnerReference(refs []metav1.OwnerReference, owner metav1.Object) []metav1.OwnerReference {
+	result := []metav1.OwnerReference{}
+	for _, ref := range refs {
+		if ref.UID != owner.GetUID() {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
+
+// equalNetworkPolicySpecs returns whether two NetworkPolicy specs are
+// semantically equal, regardless of the order of the peers of the rules
+func equalNetworkPolicySpecs(a *networking.NetworkPolicySpec, b *networking.NetworkPolicySpec) bool {
+	return equality.Semantic.DeepEqual(sortedPeers(a), sortedPeers(b))
+}
+
+// sortedPeers returns a copy of spec with the peers of each rule sorted
+func sortedPeers(spec *networking.NetworkPolicySpec) *networking.NetworkPolicySpec {
+	sorted := spec.DeepCopy()
+	for i := range sorted.Egress {
+		sortPeers(sorted.Egress[i].To)
+	}
+	for i := range sorted.Ingress {
+		sortPeers(sorted.Ingress[i].From)
+	}
+	return sorted
+}
+
+// sortPeers sorts peers in place, by their text representation
+func sortPeers(peers []networking.NetworkPolicyPeer) {
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peers[i].String() < peers[j].String()
+	})
+}
+
+// networkPolicyCIDRs returns the CIDRs of the peers of the NetworkPolicy
+func networkPolicyCIDRs(networkPolicy *networking.NetworkPolicy) map[string]bool {
+	cidrs := map[string]bool{}
+	for _, rule := range networkPolicy.Spec.Egress {
+		for _, peer := range rule.To {
+			if peer.IPBlock != nil {
+				cidrs[peer.IPBlock.CIDR] = true
+			}
+		}
+	}
+	for _, rule := range networkPolicy.Spec.Ingress {
+		for _, peer := range rule.From {
+			if peer.IPBlock != nil {
+				cidrs[peer.IPBlock.CIDR] = true
+			}
+		}
+	}
+	return cidrs
+}
+
+// diffCIDRs returns the number of CIDRs added and removed between before and after
+func diffCIDRs(before map[string]bool, after map[string]bool) (int, int) {
+	added, removed := 0, 0
+	for cidr := range after {
+		if !before[cidr] {
+			added++
+		}
+	}
+	for cidr := range before {
+		if !after[cidr] {
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// setSyncFailedConditions sets the conditions of a FQDNNetworkPolicy whose
+// NetworkPolicy couldn't be synced. The Resolved condition is Unknown if the
+// FQDNs weren't resolved, previousResolved being the one before the attempt.
+func setSyncFailedConditions(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	previousResolved *metav1.Condition, err error) {
+	var resolved *metav1.Condition
+	if c := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition); c != nil {
+		current := *c
+		resolved = &current
+	}
+	// keeping the transition time of the previous condition if it didn't change
+	meta.RemoveStatusCondition(&fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition)
+	if previousResolved != nil {
+		meta.SetStatusCondition(&fqdnNetworkPolicy.Status.Conditions, *previousResolved)
+	}
+	if resolved != nil {
+		meta.SetStatusCondition(&fqdnNetworkPolicy.Status.Conditions, *resolved)
+	} else {
+		setCondition(fqdnNetworkPolicy, networkingv1alpha3.ResolvedCondition,
+			metav1.ConditionUnknown, "NotResolved", "The FQDNs couldn't be resolved: "+err.Error())
+	}
+	setCondition(fqdnNetworkPolicy, networkingv1alpha3.NetworkPolicySyncedCondition,
+		metav1.ConditionFalse, "SyncFailed", err.Error())
+	setCondition(fqdnNetworkPolicy, networkingv1alpha3.DegradedCondition,
+		metav1.ConditionUnknown, "SyncFailed", "The NetworkPolicy couldn't be synced: "+err.Error())
+	setCondition(fqdnNetworkPolicy, networkingv1alpha3.ReadyCondition,
+		metav1.ConditionFalse, "SyncFailed", err.Error())
+}
+
+// restoreConditions sets the conditions of the provided types found in
+// status on the FQDNNetworkPolicy, leaving the others untouched
+func restoreConditions(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	status *networkingv1alpha3.FQDNNetworkPolicyStatus, conditionTypes ...string) {
+	for _, conditionType := range conditionTypes {
+		if c := meta.FindStatusCondition(status.Conditions, conditionType); c != nil {
+			meta.SetStatusCondition(&fqdnNetworkPolicy.Status.Conditions, *c)
+		}
+	}
+}
+
+// setCondition sets a condition on the status of the FQDNNetworkPolicy, for
+// its current generation
+func setCondition(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy, conditionType string,
+	status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&fqdnNetworkPolicy.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: fqdnNetworkPolicy.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setResolvedCondition sets the Resolved condition of the FQDNNetworkPolicy,
+// listing the FQDNs that couldn't be resolved if any
+func setResolvedCondition(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy, answers map[query]result) {
+	failed := []string{}
+	for q, res := range answers {
+		if res.err != nil && !containsString(failed, q.fqdn) {
+			failed = append(failed, q.fqdn)
+		}
+	}
+	if len(failed) == 0 {
+		setCondition(fqdnNetworkPolicy, networkingv1alpha3.ResolvedCondition,
+			metav1.ConditionTrue, "Resolved", "All the FQDNs have been resolved")
+		return
+	}
+	sort.Strings(failed)
+	setCondition(fqdnNetworkPolicy, networkingv1alpha3.ResolvedCondition,
+		metav1.ConditionFalse, "ResolutionFailed", "Unable to resolve "+strings.Join(failed, ", "))
+}
+
+// getFQDNStatus returns the status of fqdn, adding it to status if needed
+func getFQDNStatus(status *networkingv1alpha3.FQDNNetworkPolicyStatus, fqdn string) *networkingv1alpha3.FQDNStatus {
+	// The list is kept sorted so that the status doesn't change needlessly
+	i := sort.Search(len(status.FQDNs), func(i int) bool { return status.FQDNs[i].FQDN >= fqdn })
+	if i < len(status.FQDNs) && status.FQDNs[i].FQDN == fqdn {
+		return &status.FQDNs[i]
+	}
+	status.FQDNs = append(status.FQDNs, networkingv1alpha3.FQDNStatus{})
+	copy(status.FQDNs[i+1:], status.FQDNs[i:])
+	status.FQDNs[i] = networkingv1alpha3.FQDNStatus{FQDN: fqdn}
+	return &status.FQDNs[i]
+}
+
+// setResolutionStatus records in status how each FQDN was resolved: the
+// lowest TTL of its records, the nameserver that answered, and when it was
+// last resolved successfully, or the error if it couldn't be resolved or
+// doesn't have any address.
+func setResolutionStatus(status *networkingv1alpha3.FQDNNetworkPolicyStatus, previous []networkingv1alpha3.FQDNStatus,
+	answers map[query]result, now metav1.Time) {
+	queries := make([]query, 0, len(answers))
+	// A FQDN with addresses of either type is resolved
+	resolved := map[string]bool{}
+	for q, res := range answers {
+		queries = append(queries, q)
+		if res.err == nil && len(res.answer.Addresses) > 0 {
+			resolved[q.fqdn] = true
+		}
+	}
+	// A before AAAA, so that the errors are listed in a stable order
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].fqdn != queries[j].fqdn {
+			return queries[i].fqdn < queries[j].fqdn
+		}
+		return queries[i].recordType < queries[j].recordType
+	})
+
+	for _, q := range queries {
+		res := answers[q]
+		fqdnStatus := getFQDNStatus(status, q.fqdn)
+		if res.err != nil || !resolved[q.fqdn] {
+			var message string
+			if res.err != nil {
+				message = dns.TypeToString[q.recordType] + ": " + res.err.Error()
+			} else {
+				message = dns.TypeToString[q.recordType] + ": " + string(res.answer.Outcome)
+			}
+			if fqdnStatus.LastError != "" {
+				message = fqdnStatus.LastError + "; " + message
+			}
+			fqdnStatus.LastError = message
+			if fqdnStatus.LastResolved == nil {
+				// Keeping the last time it was resolved successfully
+				for _, p := range previous {
+					if p.FQDN == q.fqdn {
+						fqdnStatus.LastResolved = p.LastResolved
+					}
+				}
+			}
+			continue
+		}
+		ttl := int32(res.answer.MinTTL(math.MaxInt32))
+		if len(res.answer.Addresses) > 0 && (fqdnStatus.TTL == 0 || ttl < fqdnStatus.TTL) {
+			fqdnStatus.TTL = ttl
+		}
+		if res.answer.Nameserver != "" {
+			fqdnStatus.Nameserver = res.answer.Nameserver
+		}
+		fqdnStatus.LastResolved = &now
+	}
+}
+
+// maxStatusFQDNs and maxStatusAddresses bound the number of FQDNs, and the
+// number of addresses per FQDN, listed in the status of a FQDNNetworkPolicy,
+// as Kubernetes objects can't be bigger than 1.5MB.
+const (
+	maxStatusFQDNs     = 100
+	maxStatusAddresses = 50
+)
+
+// boundStatus removes FQDNs and addresses from status past the limits. The
+// addresses seen the most recently are kept. The omitted addresses won't be
+// retained in the NetworkPolicy.
+func boundStatus(status *networkingv1alpha3.FQDNNetworkPolicyStatus) {
+	status.OmittedFQDNs = 0
+	if len(status.FQDNs) > maxStatusFQDNs {
+		status.OmittedFQDNs = int32(len(status.FQDNs) - maxStatusFQDNs)
+		status.FQDNs = status.FQDNs[:maxStatusFQDNs]
+	}
+	for i := range status.FQDNs {
+		addresses := status.FQDNs[i].Addresses
+		status.FQDNs[i].OmittedAddresses = 0
+		if len(addresses) <= maxStatusAddresses {
+			continue
+		}
+		sort.SliceStable(addresses, func(i, j int) bool { return addresses[j].LastSeen.Before(&addresses[i].LastSeen) })
+		kept := addresses[:maxStatusAddresses]
+		sort.Slice(kept, func(i, j int) bool { return kept[i].IP < kept[j].IP })
+		status.FQDNs[i].Addresses = kept
+		status.FQDNs[i].OmittedAddresses = int32(len(addresses) - maxStatusAddresses)
+	}
+}
+
+// retainAddresses records in status when each address of the FQDNs was last
+// resolved. The addresses found in the previous status of the FQDNs that
+// aren't resolved anymore, but were seen less than retention ago, are added
+// back to the answers. It returns those answers, along with when the first
+// retained address expires, zero if none is retained.
+func retainAddresses(status *networkingv1alpha3.FQDNNetworkPolicyStatus, previous []networkingv1alpha3.FQDNStatus,
+	answers map[query]result, retention time.Duration, now metav1.Time) (map[query]result, time.Time) {
+	lastSeen := map[string]map[string]metav1.Time{}
+	for _, p := range previous {
+		lastSeen[p.FQDN] = map[string]metav1.Time{}
+		for _, a := range p.Addresses {
+			lastSeen[p.FQDN][a.IP] = a.LastSeen
+		}
+	}
+
+	retained := make(map[query]result, len(answers))
+	var expiry time.Time
+	for q, res := range answers {
+		retained[q] = res
+		if res.err != nil {
+			continue
+		}
+		fqdnStatus := getFQDNStatus(status, q.fqdn)
+		seen := map[string]bool{}
+		answer := &Answer{CNAMEs: res.answer.CNAMEs, Nameserver: res.answer.Nameserver,
+			Addresses: append([]Address{}, res.answer.Addresses...)}
+		for _, address := range res.answer.Addresses {
+			seen[address.IP.String()] = true
+			fqdnStatus.Addresses = append(fqdnStatus.Addresses,
+				networkingv1alpha3.AddressStatus{IP: address.IP.String(), LastSeen: now})
+		}
+		for ip, t := range lastSeen[q.fqdn] {
+			parsed := net.ParseIP(ip)
+			if seen[ip] || parsed == nil || (parsed.To4() != nil) != (q.recordType == dns.TypeA) {
+				continue
+			}
+			expires := t.Add(retention)
+			if !expires.After(now.Time) {
+				continue
+			}
+			if expiry.IsZero() || expires.Before(expiry) {
+				expiry = expires
+			}
+			// The TTL is the time left before the address expires
+			answer.Addresses = append(answer.Addresses,
+				Address{IP: parsed, TTL: uint32(expires.Sub(now.Time) / time.Second)})
+			fqdnStatus.Addresses = append(fqdnStatus.Addresses,
+				networkingv1alpha3.AddressStatus{IP: ip, LastSeen: t})
+		}
+		sort.Slice(answer.Addresses, func(i, j int) bool {
+			return answer.Addresses[i].IP.String() < answer.Addresses[j].IP.String()
+		})
+		sort.Slice(fqdnStatus.Addresses, func(i, j int) bool {
+			return fqdnStatus.Addresses[i].IP < fqdnStatus.Addresses[j].IP
+		})
+		retained[q] = result{answer: answer}
+	}
+	return retained, expiry
+}
+
+// keepLastKnownGood adds back to the answers the addresses found in the
+// previous status of the FQDNs that failed to resolve, if they were last seen
+// less than maxStaleness ago. It returns the FQDNs whose last
+// known addresses are kept, along with when the first of them goes stale,
+// zero if none is kept. Failing closed, with a maxStaleness of 0, nothing is
+// kept.
+func keepLastKnownGood(status *networkingv1alpha3.FQDNNetworkPolicyStatus, previous []networkingv1alpha3.FQDNStatus,
+	answers map[query]result, maxStaleness time.Duration, now metav1.Time) ([]string, time.Time) {
+	stale := []string{}
+	var expiry time.Time
+	if maxStaleness <= 0 {
+		return stale, expiry
+	}
+	for q, res := range answers {
+		if res.err == nil {
+			continue
+		}
+		fqdnStatus := getFQDNStatus(status, q.fqdn)
+		answer := &Answer{}
+		for _, p := range previous {
+			if p.FQDN != q.fqdn {
+				continue
+			}
+			for _, a := range p.Addresses {
+				parsed := net.ParseIP(a.IP)
+				if parsed == nil || (parsed.To4() != nil) != (q.recordType == dns.TypeA) {
+					continue
+				}
+				expires := a.LastSeen.Add(maxStaleness)
+				if !expires.After(now.Time) {
+					// Too stale, failing closed
+					continue
+				}
+				if expiry.IsZero() || expires.Before(expiry) {
+					expiry = expires
+				}
+				// The TTL is the time left before the address goes stale
+				answer.Addresses = append(answer.Addresses,
+					Address{IP: parsed, TTL: uint32(expires.Sub(now.Time) / time.Second)})
+				fqdnStatus.Addresses = append(fqdnStatus.Addresses, a)
+			}
+		}
+		if len(answer.Addresses) == 0 {
+			continue
+		}
+		sort.Slice(fqdnStatus.Addresses, func(i, j int) bool {
+			return fqdnStatus.Addresses[i].IP < fqdnStatus.Addresses[j].IP
+		})
+		answers[q] = result{answer: answer}
+		if !containsString(stale, q.fqdn) {
+			stale = append(stale, q.fqdn)
+		}
+	}
+	sort.Strings(stale)
+	return stale, expiry
+}
+
+// setDegradedCondition sets the Degraded condition of the FQDNNetworkPolicy
+// from its Resolved condition and the FQDNs whose last known addresses are
+// kept. A Warning Event is recorded when it starts or stops using the last
+// known addresses.
+func (r *FQDNNetworkPolicyReconciler) setDegradedCondition(fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	stale []string) {
+	previous := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.DegradedCondition)
+	wasStale := previous != nil && previous.Status == metav1.ConditionTrue && previous.Reason == "LastKnownGood"
+	resolved := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition)
+	switch {
+	case len(stale) > 0:
+		message := "Keeping the last known addresses of " + strings.Join(stale, ", ")
+		setCondition(fqdnNetworkPolicy, networkingv1alpha3.DegradedCondition,
+			metav1.ConditionTrue, "LastKnownGood", message)
+		if !wasStale {
+			r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeWarning, "LastKnownGood", message)
+		}
+	case resolved == nil || resolved.Status == metav1.ConditionTrue:
+		setCondition(fqdnNetworkPolicy, networkingv1alpha3.DegradedCondition,
+			metav1.ConditionFalse, "Resolved", "All the FQDNs have been resolved")
+	default:
+		setCondition(fqdnNetworkPolicy, networkingv1alpha3.DegradedCondition,
+			metav1.ConditionTrue, resolved.Reason, resolved.Message)
+		if wasStale {
+			r.Recorder.Event(fqdnNetworkPolicy, corev1.EventTypeWarning, "MaxStalenessExceeded",
+				"Removed the last known addresses of the FQDNs that still can't be resolved")
+		}
+	}
+}
+
+// syncIntervals bound the time between two syncs of a FQDNNetworkPolicy
+type syncIntervals struct {
+	// minTTL is the lowest time between two resolutions of a FQDN
+	minTTL time.Duration
+	// maxTTL is the highest time between two resolutions of a FQDN
+	maxTTL time.Duration
+	// retry is how long to wait before trying again after an error
+	retry time.Duration
+	// retention is how long addresses are kept after they stopped being resolved
+	retention time.Duration
+	// maxStaleness is how long the last known addresses of a FQDN are kept
+	// after it failed to resolve, 0 to remove them right away
+	maxStaleness time.Duration
+}
+
+// backoff returns how long to wait before trying again after attempts
+// consecutive failures: retry, doubled on each failure up to max (or retry if
+// it's higher), with up to 10% of jitter so that the FQDNNetworkPolicies that
+// failed together don't retry together. The jitter doesn't go past max.
+func backoff(retry, max time.Duration, attempts int32) time.Duration {
+	if max < retry {
+		max = retry
+	}
+	d := retry
+	for i := int32(1); i < attempts && d < max; i++ {
+		d *= 2
+	}
+	d = wait.Jitter(d, 0.1)
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// maxTTLSeconds returns maxTTL in seconds, the unit of the TTL of the records
+func (i syncIntervals) maxTTLSeconds() uint32 {
+	return uint32(i.maxTTL / time.Second)
+}
+
+// clamp returns d bounded by the minimum and maximum TTLs
+func (i syncIntervals) clamp(d time.Duration) time.Duration {
+	if d > i.maxTTL {
+		d = i.maxTTL
+	}
+	if d < i.minTTL {
+		d = i.minTTL
+	}
+	// records with a TTL of 0 mustn't make the controller spin
+	if d < minRefresh {
+		d = minRefresh
+	}
+	return d
+}
+
+// refreshIn returns how long until the answer needs to be resolved again
+func (i syncIntervals) refreshIn(answer *Answer) time.Duration {
+	return i.clamp(time.Duration(answer.MinTTL(i.maxTTLSeconds())) * time.Second)
+}
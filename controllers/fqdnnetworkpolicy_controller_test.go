@@ -25,12 +25,16 @@ import (
 	"time"
 
 	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
 
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -56,50 +60,14 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 			It("Should create a NetworkPolicy of the same name with the correct CIDRs", func() {
 				Expect(k8sClient.Create(ctx, &fqdnNetworkPolicy)).Should(Succeed())
 				Eventually(func() error {
-					r := net.Resolver{}
 					// computing the expected IPs in the NetworkPolicy
 					// from the FQDNs in the FQDNNetworkPolicy
-					// We use a different lib for resolving than the one in the main code
 					expectedIPs := []string{}
 					for _, fer := range fqdnNetworkPolicy.Spec.Egress {
 						for _, to := range fer.To {
 							for _, fqdn := range to.FQDNs {
-								ip4s, err := r.LookupIP(ctx, "ip4", fqdn)
-								if err != nil {
-									continuing := false
-									derr, ok := err.(*net.DNSError)
-									if ok && derr.IsNotFound {
-										continuing = true
-									}
-									aerr, ok := err.(*net.AddrError)
-									if ok && aerr.Err == "no suitable address found" {
-										continuing = true
-									}
-									if !continuing {
-										return err
-									}
-								}
-								for _, ip := range ip4s {
-									expectedIPs = append(expectedIPs, ip.String()+"/32")
-								}
-								ip6s, err := r.LookupIP(ctx, "ip6", fqdn)
-								if err != nil {
-									continuing := false
-									derr, ok := err.(*net.DNSError)
-									if ok && derr.IsNotFound {
-										continuing = true
-									}
-									aerr, ok := err.(*net.AddrError)
-									if ok && aerr.Err == "no suitable address found" {
-										continuing = true
-									}
-									if !continuing {
-										return err
-									}
-								}
-								for _, ip := range ip6s {
-									expectedIPs = append(expectedIPs, ip.String()+"/128")
-								}
+								expectedIPs = append(expectedIPs, fakeDNS.cidrs(fqdn, dns.TypeA)...)
+								expectedIPs = append(expectedIPs, fakeDNS.cidrs(fqdn, dns.TypeAAAA)...)
 							}
 						}
 					}
@@ -133,12 +101,41 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 					return nil
 				}).Should(Succeed())
 			})
-			It("Should delete the NetworkPolicy when it's deleted", func() {
-				Expect(k8sClient.Delete(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+			It("Should be Ready once the NetworkPolicy is created", func() {
+				Eventually(func() error {
+					f := networkingv1alpha3.FQDNNetworkPolicy{}
+					if err := k8sClient.Get(ctx, nn, &f); err != nil {
+						return err
+					}
+					if !meta.IsStatusConditionTrue(f.Status.Conditions, networkingv1alpha3.ReadyCondition) {
+						return errors.New("FQDNNetworkPolicy is not Ready: " + fmt.Sprint(f.Status.Conditions))
+					}
+					if f.Status.ObservedGeneration != f.Generation || f.Status.LastSyncTime == nil {
+						return errors.New("unexpected status: " + fmt.Sprint(f.Status))
+					}
+					return nil
+				}).Should(Succeed())
+			})
+			It("Should control the NetworkPolicy and recreate it when it's deleted", func() {
+				networkPolicy := networking.NetworkPolicy{}
+				Expect(k8sClient.Get(ctx, nn, &networkPolicy)).Should(Succeed())
+				Expect(k8sClient.Get(ctx, nn, &fqdnNetworkPolicy)).Should(Succeed())
+				Expect(metav1.IsControlledBy(&networkPolicy, &fqdnNetworkPolicy)).Should(BeTrue())
+				uid := networkPolicy.UID
+				Expect(k8sClient.Delete(ctx, &networkPolicy)).Should(Succeed())
 				Eventually(func() error {
 					networkPolicy := networking.NetworkPolicy{}
-					return k8sClient.Get(ctx, nn, &networkPolicy)
-				}).ShouldNot(Succeed())
+					if err := k8sClient.Get(ctx, nn, &networkPolicy); err != nil {
+						return err
+					}
+					if networkPolicy.UID == uid {
+						return errors.New("NetworkPolicy hasn't been recreated yet")
+					}
+					return nil
+				}).Should(Succeed())
+			})
+			It("Should delete the NetworkPolicy when it's deleted", func() {
+				expectGarbageCollected(ctx, &fqdnNetworkPolicy, nn)
 			})
 		})
 		Context("with an Ingress policy", func() {
@@ -153,50 +150,14 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 			It("Should create a NetworkPolicy of the same name with an Ingress rule with the correct CIDRs", func() {
 				Expect(k8sClient.Create(ctx, &fqdnNetworkPolicy)).Should(Succeed())
 				Eventually(func() error {
-					r := net.Resolver{}
 					// computing the expected IPs in the NetworkPolicy
 					// from the FQDNs in the FQDNNetworkPolicy
-					// We use a different lib for resolving than the one in the main code
 					expectedIPs := []string{}
 					for _, fir := range fqdnNetworkPolicy.Spec.Ingress {
 						for _, from := range fir.From {
 							for _, fqdn := range from.FQDNs {
-								ip4s, err := r.LookupIP(ctx, "ip4", fqdn)
-								if err != nil {
-									continuing := false
-									derr, ok := err.(*net.DNSError)
-									if ok && derr.IsNotFound {
-										continuing = true
-									}
-									aerr, ok := err.(*net.AddrError)
-									if ok && aerr.Err == "no suitable address found" {
-										continuing = true
-									}
-									if !continuing {
-										return err
-									}
-								}
-								for _, ip := range ip4s {
-									expectedIPs = append(expectedIPs, ip.String()+"/32")
-								}
-								ip6s, err := r.LookupIP(ctx, "ip6", fqdn)
-								if err != nil {
-									continuing := false
-									derr, ok := err.(*net.DNSError)
-									if ok && derr.IsNotFound {
-										continuing = true
-									}
-									aerr, ok := err.(*net.AddrError)
-									if ok && aerr.Err == "no suitable address found" {
-										continuing = true
-									}
-									if !continuing {
-										return err
-									}
-								}
-								for _, ip := range ip6s {
-									expectedIPs = append(expectedIPs, ip.String()+"/128")
-								}
+								expectedIPs = append(expectedIPs, fakeDNS.cidrs(fqdn, dns.TypeA)...)
+								expectedIPs = append(expectedIPs, fakeDNS.cidrs(fqdn, dns.TypeAAAA)...)
 							}
 						}
 					}
@@ -231,11 +192,7 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 				}).Should(Succeed())
 			})
 			It("Should delete the NetworkPolicy when it's deleted", func() {
-				Expect(k8sClient.Delete(ctx, &fqdnNetworkPolicy)).Should(Succeed())
-				Eventually(func() error {
-					networkPolicy := networking.NetworkPolicy{}
-					return k8sClient.Get(ctx, nn, &networkPolicy)
-				}).ShouldNot(Succeed())
+				expectGarbageCollected(ctx, &fqdnNetworkPolicy, nn)
 			})
 		})
 		Context("with a non-existent FQDN", func() {
@@ -261,11 +218,72 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 				}).Should(Succeed())
 			})
 			It("Should delete the NetworkPolicy when it's deleted", func() {
-				Expect(k8sClient.Delete(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+				expectGarbageCollected(ctx, &fqdnNetworkPolicy, nn)
+			})
+		})
+		Context("when a FQDN stops resolving with the keep-last-known-good failure policy", func() {
+			ctx := context.Background()
+			fqdnNetworkPolicy := getFQDNNetworkPolicy("context7", "default")
+			// Resolving the FQDNs again every second, without any change
+			// to the FQDNNetworkPolicy
+			fqdnNetworkPolicy.Annotations = map[string]string{
+				failurePolicyAnnotation: KeepLastKnownGood,
+				minTTLAnnotation:        "1s",
+				retryAnnotation:         "1s",
+			}
+			fqdnNetworkPolicy.Spec.Egress[0].To = []networkingv1alpha3.FQDNNetworkPolicyPeer{
+				{FQDNs: []string{"flaky.example.com"}}}
+			nn := types.NamespacedName{
+				Namespace: fqdnNetworkPolicy.Namespace,
+				Name:      fqdnNetworkPolicy.Name,
+			}
+			// cidrs returns the CIDRs of the egress rules of the NetworkPolicy
+			cidrs := func() ([]string, error) {
+				networkPolicy := networking.NetworkPolicy{}
+				if err := k8sClient.Get(ctx, nn, &networkPolicy); err != nil {
+					return nil, err
+				}
+				cidrs := []string{}
+				for _, rule := range networkPolicy.Spec.Egress {
+					for _, to := range rule.To {
+						cidrs = append(cidrs, to.IPBlock.CIDR)
+					}
+				}
+				return cidrs, nil
+			}
+			// expectCondition waits for the scheduler to resolve the FQDNs
+			// again, and for the condition to have the expected status
+			expectCondition := func(conditionType string, status metav1.ConditionStatus, reason string) {
+				// Long enough for the TTL to expire, the queries to time out
+				// and the FQDNNetworkPolicy to be reconciled
 				Eventually(func() error {
-					networkPolicy := networking.NetworkPolicy{}
-					return k8sClient.Get(ctx, nn, &networkPolicy)
-				}).ShouldNot(Succeed())
+					f := networkingv1alpha3.FQDNNetworkPolicy{}
+					if err := k8sClient.Get(ctx, nn, &f); err != nil {
+						return err
+					}
+					c := meta.FindStatusCondition(f.Status.Conditions, conditionType)
+					if c == nil || c.Status != status || c.Reason != reason {
+						return errors.New("FQDNs not resolved again yet: " + fmt.Sprint(f.Status.Conditions))
+					}
+					return nil
+				}, 4*TIMEOUT).Should(Succeed())
+			}
+			It("Should keep the addresses on a timeout", func() {
+				Expect(fakeDNS.add("flaky.example.com. 1 IN A 192.0.2.10")).Should(Succeed())
+				Expect(k8sClient.Create(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+				Eventually(cidrs).Should(ConsistOf("192.0.2.10/32"))
+				fakeDNS.drop("flaky.example.com", true)
+				expectCondition(networkingv1alpha3.DegradedCondition, metav1.ConditionTrue, "LastKnownGood")
+				Expect(cidrs()).Should(ConsistOf("192.0.2.10/32"))
+			})
+			It("Should remove the addresses on a NXDOMAIN", func() {
+				fakeDNS.remove("flaky.example.com")
+				fakeDNS.drop("flaky.example.com", false)
+				expectCondition(networkingv1alpha3.DegradedCondition, metav1.ConditionFalse, "Resolved")
+				Eventually(cidrs).Should(BeEmpty())
+			})
+			It("Should delete the NetworkPolicy when it's deleted", func() {
+				expectGarbageCollected(ctx, &fqdnNetworkPolicy, nn)
 			})
 		})
 		Context("when a conflicting NetworkPolicy already exists", func() {
@@ -316,11 +334,7 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 				}
 			})
 			It("Should delete the existing NetworkPolicy when it gets deleted", func() {
-				Expect(k8sClient.Delete(ctx, &fqdnNetworkPolicy)).Should(Succeed())
-				Eventually(func() error {
-					networkPolicy := networking.NetworkPolicy{}
-					return k8sClient.Get(ctx, nn, &networkPolicy)
-				}).ShouldNot(Succeed())
+				expectGarbageCollected(ctx, &fqdnNetworkPolicy, nn)
 			})
 		})
 		Context("when the NetworkPolicy has the abandon delete-policy", func() {
@@ -350,6 +364,47 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 				Expect(k8sClient.Delete(ctx, &networkPolicy)).Should(Succeed())
 			})
 		})
+		Context("when another tool adds metadata to the NetworkPolicy", func() {
+			ctx := context.Background()
+			fqdnNetworkPolicy := getFQDNNetworkPolicy("context6", "default")
+			nn := types.NamespacedName{
+				Namespace: fqdnNetworkPolicy.Namespace,
+				Name:      fqdnNetworkPolicy.Name,
+			}
+			It("Should keep that metadata when updating the NetworkPolicy", func() {
+				Expect(k8sClient.Create(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+				networkPolicy := networking.NetworkPolicy{}
+				Eventually(func() error {
+					return k8sClient.Get(ctx, nn, &networkPolicy)
+				}).Should(Succeed())
+
+				// adding a label, as another tool would
+				networkPolicy.Labels = map[string]string{"team": "payments"}
+				Expect(k8sClient.Update(ctx, &networkPolicy)).Should(Succeed())
+
+				// changing the FQDNNetworkPolicy so that the NetworkPolicy gets updated
+				Expect(k8sClient.Get(ctx, nn, &fqdnNetworkPolicy)).Should(Succeed())
+				fqdnNetworkPolicy.Spec.Egress[0].To[0].FQDNs = []string{"gitlab.com"}
+				Expect(k8sClient.Update(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+				Eventually(func() error {
+					networkPolicy := networking.NetworkPolicy{}
+					if err := k8sClient.Get(ctx, nn, &networkPolicy); err != nil {
+						return err
+					}
+					cidrs := networkPolicyCIDRs(&networkPolicy)
+					for _, cidr := range fakeDNS.cidrs("github.com", dns.TypeA) {
+						if cidrs[cidr] {
+							return errors.New("NetworkPolicy hasn't been updated yet")
+						}
+					}
+					if networkPolicy.Labels["team"] != "payments" {
+						return errors.New("label removed from the NetworkPolicy")
+					}
+					return nil
+				}).Should(Succeed())
+				Expect(k8sClient.Delete(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+			})
+		})
 		Context("when the NetworkPolicy has the aaaa-lookups annotation set to skip", func() {
 			ctx := context.Background()
 			fqdnNetworkPolicy := getFQDNNetworkPolicy("context5", "default")
@@ -368,32 +423,13 @@ var _ = Describe("FQDNNetworkPolicy controller", func() {
 
 				// check only ipv4 adresses are present
 				Eventually(func() error {
-					r := net.Resolver{}
 					// computing the expected IPs in the NetworkPolicy
 					// from the FQDNs in the FQDNNetworkPolicy
-					// We use a different lib for resolving than the one in the main code
 					expectedIPs := []string{}
 					for _, fer := range fqdnNetworkPolicy.Spec.Egress {
 						for _, to := range fer.To {
 							for _, fqdn := range to.FQDNs {
-								ip4s, err := r.LookupIP(ctx, "ip4", fqdn)
-								if err != nil {
-									continuing := false
-									derr, ok := err.(*net.DNSError)
-									if ok && derr.IsNotFound {
-										continuing = true
-									}
-									aerr, ok := err.(*net.AddrError)
-									if ok && aerr.Err == "no suitable address found" {
-										continuing = true
-									}
-									if !continuing {
-										return err
-									}
-								}
-								for _, ip := range ip4s {
-									expectedIPs = append(expectedIPs, ip.String()+"/32")
-								}
+								expectedIPs = append(expectedIPs, fakeDNS.cidrs(fqdn, dns.TypeA)...)
 							}
 						}
 					}
@@ -451,6 +487,424 @@ func TestRemoveString(t *testing.T) {
 	}
 }
 
+func TestRetainAddresses(t *testing.T) {
+	now := metav1.Now()
+	recently := metav1.NewTime(now.Add(-time.Minute))
+	longAgo := metav1.NewTime(now.Add(-time.Hour))
+	previous := []networkingv1alpha3.FQDNStatus{{
+		FQDN: "github.com",
+		Addresses: []networkingv1alpha3.AddressStatus{
+			{IP: "192.0.2.1", LastSeen: recently},
+			{IP: "192.0.2.2", LastSeen: recently},
+			{IP: "192.0.2.3", LastSeen: longAgo},
+			{IP: "2001:db8::1", LastSeen: recently},
+		},
+	}}
+	answers := map[query]result{
+		{fqdn: "github.com", recordType: dns.TypeA}: {answer: &Answer{
+			Addresses: []Address{{IP: net.ParseIP("192.0.2.1"), TTL: 30}}}},
+	}
+
+	status := networkingv1alpha3.FQDNNetworkPolicyStatus{}
+	retained, expiry := retainAddresses(&status, previous, answers, 10*time.Minute, now)
+	addresses := sortedAddresses(retained[query{fqdn: "github.com", recordType: dns.TypeA}].answer)
+	// 192.0.2.3 expired, and 2001:db8::1 is not an A record
+	if !equalStrings(addresses, []string{"192.0.2.1", "192.0.2.2"}) {
+		t.Errorf("unexpected addresses %v", addresses)
+	}
+	if !expiry.Equal(recently.Add(10 * time.Minute)) {
+		t.Errorf("unexpected expiry %s", expiry)
+	}
+	expected := []networkingv1alpha3.AddressStatus{
+		{IP: "192.0.2.1", LastSeen: now},
+		{IP: "192.0.2.2", LastSeen: recently},
+	}
+	if len(status.FQDNs) != 1 || fmt.Sprint(status.FQDNs[0].Addresses) != fmt.Sprint(expected) {
+		t.Errorf("unexpected status %v", status.FQDNs)
+	}
+
+	// Without retention, only the addresses resolved are kept
+	status = networkingv1alpha3.FQDNNetworkPolicyStatus{}
+	retained, expiry = retainAddresses(&status, previous, answers, 0, now)
+	addresses = sortedAddresses(retained[query{fqdn: "github.com", recordType: dns.TypeA}].answer)
+	if !equalStrings(addresses, []string{"192.0.2.1"}) || !expiry.IsZero() {
+		t.Errorf("unexpected addresses %v expiring at %s", addresses, expiry)
+	}
+}
+
+func TestKeepLastKnownGood(t *testing.T) {
+	now := metav1.Now()
+	recently := metav1.NewTime(now.Add(-time.Minute))
+	longAgo := metav1.NewTime(now.Add(-2 * time.Hour))
+	previous := []networkingv1alpha3.FQDNStatus{{
+		FQDN: "github.com",
+		Addresses: []networkingv1alpha3.AddressStatus{
+			{IP: "192.0.2.1", LastSeen: recently},
+			{IP: "192.0.2.2", LastSeen: longAgo},
+			{IP: "2001:db8::1", LastSeen: recently},
+		},
+	}, {
+		FQDN:      "gitlab.com",
+		Addresses: []networkingv1alpha3.AddressStatus{{IP: "192.0.2.3", LastSeen: longAgo}},
+	}}
+	answers := func() map[query]result {
+		return map[query]result{
+			{fqdn: "github.com", recordType: dns.TypeA}: {err: errors.New("i/o timeout")},
+			{fqdn: "gitlab.com", recordType: dns.TypeA}: {err: errors.New("i/o timeout")},
+		}
+	}
+
+	status := networkingv1alpha3.FQDNNetworkPolicyStatus{}
+	retained := answers()
+	stale, expiry := keepLastKnownGood(&status, previous, retained, time.Hour, now)
+	// gitlab.com was last seen too long ago
+	if !equalStrings(stale, []string{"github.com"}) {
+		t.Errorf("unexpected stale FQDNs %v", stale)
+	}
+	if !expiry.Equal(recently.Add(time.Hour)) {
+		t.Errorf("unexpected expiry %s", expiry)
+	}
+	res := retained[query{fqdn: "github.com", recordType: dns.TypeA}]
+	if res.err != nil || !equalStrings(sortedAddresses(res.answer), []string{"192.0.2.1"}) {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if res := retained[query{fqdn: "gitlab.com", recordType: dns.TypeA}]; res.err == nil {
+		t.Errorf("expected gitlab.com to fail closed")
+	}
+	expected := []networkingv1alpha3.AddressStatus{{IP: "192.0.2.1", LastSeen: recently}}
+	if fmt.Sprint(getFQDNStatus(&status, "github.com").Addresses) != fmt.Sprint(expected) {
+		t.Errorf("unexpected status %v", status.FQDNs)
+	}
+
+	// Failing closed, nothing is kept
+	retained = answers()
+	stale, expiry = keepLastKnownGood(&networkingv1alpha3.FQDNNetworkPolicyStatus{}, previous, retained, 0, now)
+	if len(stale) != 0 || !expiry.IsZero() ||
+		retained[query{fqdn: "github.com", recordType: dns.TypeA}].err == nil {
+		t.Errorf("unexpected stale FQDNs %v expiring at %s", stale, expiry)
+	}
+
+	// The NXDOMAIN and NODATA answers aren't failures, nothing is kept
+	retained = map[query]result{
+		{fqdn: "github.com", recordType: dns.TypeA}: {answer: &Answer{Outcome: OutcomeNXDomain}},
+		{fqdn: "gitlab.com", recordType: dns.TypeA}: {answer: &Answer{Outcome: OutcomeNoData}},
+	}
+	stale, _ = keepLastKnownGood(&networkingv1alpha3.FQDNNetworkPolicyStatus{}, previous, retained, time.Hour, now)
+	for q, res := range retained {
+		if len(stale) != 0 || res.err != nil || len(res.answer.Addresses) != 0 {
+			t.Errorf("unexpected result for %s %+v", q.fqdn, res)
+		}
+	}
+}
+
+func TestSetDegradedCondition(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &FQDNNetworkPolicyReconciler{Recorder: recorder}
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	failed := map[query]result{{fqdn: "github.com", recordType: dns.TypeA}: {err: errors.New("i/o timeout")}}
+	setResolvedCondition(&fqdnNetworkPolicy, failed)
+
+	for i, step := range []struct {
+		stale  []string
+		status metav1.ConditionStatus
+		reason string
+		event  string
+	}{
+		{[]string{"github.com"}, metav1.ConditionTrue, "LastKnownGood",
+			"Warning LastKnownGood Keeping the last known addresses of github.com"},
+		{[]string{"github.com"}, metav1.ConditionTrue, "LastKnownGood", ""},
+		{[]string{}, metav1.ConditionTrue, "ResolutionFailed",
+			"Warning MaxStalenessExceeded Removed the last known addresses of the FQDNs that still can't be resolved"},
+		{[]string{}, metav1.ConditionTrue, "ResolutionFailed", ""},
+	} {
+		r.setDegradedCondition(&fqdnNetworkPolicy, step.stale)
+		c := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.DegradedCondition)
+		if c.Status != step.status || c.Reason != step.reason {
+			t.Errorf("step %d: unexpected condition %+v", i, c)
+		}
+		event := ""
+		select {
+		case event = <-recorder.Events:
+		default:
+		}
+		if event != step.event {
+			t.Errorf("step %d: unexpected event %q", i, event)
+		}
+	}
+
+	setResolvedCondition(&fqdnNetworkPolicy, map[query]result{})
+	r.setDegradedCondition(&fqdnNetworkPolicy, []string{})
+	if !meta.IsStatusConditionFalse(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.DegradedCondition) {
+		t.Errorf("expected the FQDNNetworkPolicy not to be degraded anymore")
+	}
+}
+
+func TestSetResolvedCondition(t *testing.T) {
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	fqdnNetworkPolicy.Generation = 2
+	answers := map[query]result{
+		{fqdn: "github.com", recordType: dns.TypeA}:    {answer: &Answer{}},
+		{fqdn: "gitlab.com", recordType: dns.TypeA}:    {err: errors.New("timeout")},
+		{fqdn: "gitlab.com", recordType: dns.TypeAAAA}: {err: errors.New("timeout")},
+	}
+	setResolvedCondition(&fqdnNetworkPolicy, answers)
+	c := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition)
+	if c == nil || c.Status != metav1.ConditionFalse || c.Message != "Unable to resolve gitlab.com" || c.ObservedGeneration != 2 {
+		t.Errorf("unexpected condition %+v", c)
+	}
+
+	delete(answers, query{fqdn: "gitlab.com", recordType: dns.TypeA})
+	delete(answers, query{fqdn: "gitlab.com", recordType: dns.TypeAAAA})
+	setResolvedCondition(&fqdnNetworkPolicy, answers)
+	if !meta.IsStatusConditionTrue(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition) {
+		t.Errorf("expected the Resolved condition to be True")
+	}
+}
+
+func TestSetSyncFailedConditions(t *testing.T) {
+	longAgo := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	previous := metav1.Condition{Type: networkingv1alpha3.ResolvedCondition, Status: metav1.ConditionFalse,
+		Reason: "ResolutionFailed", Message: "Unable to resolve gitlab.com", LastTransitionTime: longAgo}
+	err := errors.New("conflict")
+
+	// The FQDNs weren't resolved
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	setSyncFailedConditions(&fqdnNetworkPolicy, &previous, err)
+	conditions := fqdnNetworkPolicy.Status.Conditions
+	if c := meta.FindStatusCondition(conditions, networkingv1alpha3.ResolvedCondition); c == nil ||
+		c.Status != metav1.ConditionUnknown || c.Reason != "NotResolved" {
+		t.Errorf("unexpected Resolved condition %+v", c)
+	}
+	if c := meta.FindStatusCondition(conditions, networkingv1alpha3.DegradedCondition); c == nil ||
+		c.Status != metav1.ConditionUnknown || c.Reason != "SyncFailed" {
+		t.Errorf("unexpected Degraded condition %+v", c)
+	}
+	if !meta.IsStatusConditionFalse(conditions, networkingv1alpha3.ReadyCondition) ||
+		!meta.IsStatusConditionFalse(conditions, networkingv1alpha3.NetworkPolicySyncedCondition) {
+		t.Errorf("unexpected conditions %+v", conditions)
+	}
+
+	// The FQDNs were resolved, still failing to
+	fqdnNetworkPolicy = getFQDNNetworkPolicy("test", "default")
+	setResolvedCondition(&fqdnNetworkPolicy, map[query]result{
+		{fqdn: "gitlab.com", recordType: dns.TypeA}: {err: errors.New("timeout")}})
+	setSyncFailedConditions(&fqdnNetworkPolicy, &previous, err)
+	if c := meta.FindStatusCondition(fqdnNetworkPolicy.Status.Conditions, networkingv1alpha3.ResolvedCondition); c == nil ||
+		c.Status != metav1.ConditionFalse || !c.LastTransitionTime.Equal(&longAgo) {
+		t.Errorf("unexpected Resolved condition %+v", c)
+	}
+}
+
+func TestSetResolutionStatus(t *testing.T) {
+	now := metav1.Now()
+	before := metav1.NewTime(now.Add(-time.Minute))
+	previous := []networkingv1alpha3.FQDNStatus{{FQDN: "gitlab.com", LastResolved: &before},
+		{FQDN: "gone.example.com", LastResolved: &before}}
+	answers := map[query]result{
+		{fqdn: "github.com", recordType: dns.TypeA}: {answer: &Answer{Nameserver: "192.0.2.53",
+			Addresses: []Address{{IP: net.ParseIP("192.0.2.1"), TTL: 60}, {IP: net.ParseIP("192.0.2.2"), TTL: 30}}}},
+		{fqdn: "github.com", recordType: dns.TypeAAAA}: {answer: &Answer{}},
+		{fqdn: "gitlab.com", recordType: dns.TypeA}:    {err: errors.New("i/o timeout")},
+		{fqdn: "gitlab.com", recordType: dns.TypeAAAA}: {err: errors.New("SERVFAIL")},
+		// Negative answers aren't successful resolutions either
+		{fqdn: "gone.example.com", recordType: dns.TypeA}:  {answer: &Answer{Outcome: OutcomeNXDomain}},
+		{fqdn: "empty.example.com", recordType: dns.TypeA}: {answer: &Answer{Outcome: OutcomeNoData}},
+	}
+
+	status := networkingv1alpha3.FQDNNetworkPolicyStatus{}
+	setResolutionStatus(&status, previous, answers, now)
+	if len(status.FQDNs) != 4 {
+		t.Fatalf("expected 4 FQDNs, got %v", status.FQDNs)
+	}
+	empty := status.FQDNs[0]
+	if empty.FQDN != "empty.example.com" || empty.LastError != "A: "+string(OutcomeNoData) || empty.LastResolved != nil {
+		t.Errorf("unexpected status for empty.example.com: %+v", empty)
+	}
+	github := status.FQDNs[1]
+	if github.FQDN != "github.com" || github.TTL != 30 || github.Nameserver != "192.0.2.53" ||
+		github.LastResolved == nil || !github.LastResolved.Equal(&now) || github.LastError != "" {
+		t.Errorf("unexpected status for github.com: %+v", github)
+	}
+	gitlab := status.FQDNs[2]
+	if gitlab.FQDN != "gitlab.com" || gitlab.LastError != "A: i/o timeout; AAAA: SERVFAIL" ||
+		gitlab.LastResolved == nil || !gitlab.LastResolved.Equal(&before) {
+		t.Errorf("unexpected status for gitlab.com: %+v", gitlab)
+	}
+	gone := status.FQDNs[3]
+	if gone.FQDN != "gone.example.com" || gone.LastError != "A: NXDOMAIN" ||
+		gone.LastResolved == nil || !gone.LastResolved.Equal(&before) {
+		t.Errorf("unexpected status for gone.example.com: %+v", gone)
+	}
+}
+
+func TestBoundStatus(t *testing.T) {
+	now := metav1.Now()
+	before := metav1.NewTime(now.Add(-time.Minute))
+	status := networkingv1alpha3.FQDNNetworkPolicyStatus{}
+	for i := 0; i < maxStatusFQDNs+10; i++ {
+		getFQDNStatus(&status, fmt.Sprintf("host%03d.example.com", i))
+	}
+	for i := 0; i < maxStatusAddresses+5; i++ {
+		lastSeen := now
+		if i < 5 {
+			lastSeen = before
+		}
+		status.FQDNs[0].Addresses = append(status.FQDNs[0].Addresses,
+			networkingv1alpha3.AddressStatus{IP: fmt.Sprintf("192.0.2.%d", i), LastSeen: lastSeen})
+	}
+
+	boundStatus(&status)
+	if len(status.FQDNs) != maxStatusFQDNs || status.OmittedFQDNs != 10 {
+		t.Errorf("expected %d FQDNs and 10 omitted, got %d and %d", maxStatusFQDNs, len(status.FQDNs), status.OmittedFQDNs)
+	}
+	addresses := status.FQDNs[0].Addresses
+	if len(addresses) != maxStatusAddresses || status.FQDNs[0].OmittedAddresses != 5 {
+		t.Errorf("expected %d addresses and 5 omitted, got %d and %d",
+			maxStatusAddresses, len(addresses), status.FQDNs[0].OmittedAddresses)
+	}
+	// the addresses seen the longest ago are the ones omitted
+	for _, a := range addresses {
+		if a.LastSeen.Equal(&before) {
+			t.Errorf("address %s should have been omitted", a.IP)
+		}
+	}
+}
+
+func TestRemoveOwnerReference(t *testing.T) {
+	owner := getFQDNNetworkPolicy("test", "default")
+	owner.UID = "1234"
+	refs := []metav1.OwnerReference{{Name: "test", UID: "1234"}, {Name: "other", UID: "5678"}}
+	refs = removeOwnerReference(refs, &owner)
+	if len(refs) != 1 || refs[0].UID != "5678" {
+		t.Errorf("unexpected owner references %v", refs)
+	}
+}
+
+func TestAbandoned(t *testing.T) {
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	networkPolicy := getNetworkPolicy("test", "default")
+	if abandoned(&fqdnNetworkPolicy, &networkPolicy) {
+		t.Error("NetworkPolicy abandoned without any delete-policy annotation")
+	}
+	// set on the NetworkPolicy, or on the FQDNNetworkPolicy by the
+	// deletePolicy of the v1beta1 API
+	networkPolicy.Annotations = map[string]string{deletePolicyAnnotation: "abandon"}
+	if !abandoned(&fqdnNetworkPolicy, &networkPolicy) {
+		t.Error("NetworkPolicy with the abandon delete-policy not abandoned")
+	}
+	networkPolicy.Annotations = nil
+	fqdnNetworkPolicy.Annotations = map[string]string{deletePolicyAnnotation: "abandon"}
+	if !abandoned(&fqdnNetworkPolicy, &networkPolicy) {
+		t.Error("FQDNNetworkPolicy with the abandon delete-policy not abandoned")
+	}
+}
+
+func TestEqualNetworkPolicySpecs(t *testing.T) {
+	a := getNetworkPolicy("test", "default")
+	a.Spec.Egress[0].To = []networking.NetworkPolicyPeer{
+		{IPBlock: &networking.IPBlock{CIDR: "192.168.1.1/32"}},
+		{IPBlock: &networking.IPBlock{CIDR: "192.168.1.2/32"}},
+	}
+	b := a.DeepCopy()
+	b.Spec.Egress[0].To[0], b.Spec.Egress[0].To[1] = b.Spec.Egress[0].To[1], b.Spec.Egress[0].To[0]
+	if !equalNetworkPolicySpecs(&a.Spec, &b.Spec) {
+		t.Error("the order of the peers shouldn't matter")
+	}
+	// the specs are left untouched
+	if b.Spec.Egress[0].To[0].IPBlock.CIDR != "192.168.1.2/32" {
+		t.Error("the peers have been sorted in place")
+	}
+	b.Spec.Egress[0].To[0].IPBlock.CIDR = "192.168.1.3/32"
+	if equalNetworkPolicySpecs(&a.Spec, &b.Spec) {
+		t.Error("different CIDRs should make the specs different")
+	}
+	b = a.DeepCopy()
+	b.Spec.Ingress = []networking.NetworkPolicyIngressRule{}
+	if !equalNetworkPolicySpecs(&a.Spec, &b.Spec) {
+		t.Error("empty and missing rules should be equal")
+	}
+}
+
+func TestGetPeers(t *testing.T) {
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}}
+	ipBlock := &networking.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}
+	fqdnPeers := []networkingv1alpha3.FQDNNetworkPolicyPeer{
+		{FQDNs: []string{"github.com", "www.github.com"}},
+		{IPBlock: ipBlock},
+		{PodSelector: selector, NamespaceSelector: selector},
+	}
+	address := &Answer{Addresses: []Address{{IP: net.ParseIP("192.0.2.1"), TTL: 30}}}
+	answers := map[query]result{
+		{fqdn: "github.com", recordType: dns.TypeA}:     {answer: address},
+		{fqdn: "www.github.com", recordType: dns.TypeA}: {answer: address},
+	}
+
+	nextSync := uint32(60)
+	peers := getPeers(logr.Discard(), &fqdnNetworkPolicy, fqdnPeers, answers, &nextSync, 0)
+	// the address is listed once, and the other peers are kept as is
+	expected := []networking.NetworkPolicyPeer{
+		{IPBlock: &networking.IPBlock{CIDR: "192.0.2.1/32"}},
+		{IPBlock: ipBlock},
+		{PodSelector: selector, NamespaceSelector: selector},
+	}
+	if fmt.Sprint(peers) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+	if nextSync != 30 {
+		t.Errorf("expected the next sync in 30s, got %d", nextSync)
+	}
+}
+
+func TestDiffCIDRs(t *testing.T) {
+	networkPolicy := getNetworkPolicy("test", "default")
+	before := networkPolicyCIDRs(&networkPolicy)
+	networkPolicy.Spec.Egress[0].To = []networking.NetworkPolicyPeer{
+		{IPBlock: &networking.IPBlock{CIDR: "192.168.1.2/32"}},
+		{IPBlock: &networking.IPBlock{CIDR: "192.168.1.3/32"}},
+	}
+	added, removed := diffCIDRs(before, networkPolicyCIDRs(&networkPolicy))
+	if added != 2 || removed != 1 {
+		t.Errorf("expected 2 CIDRs added and 1 removed, got %d and %d", added, removed)
+	}
+}
+
+func TestRecordResolutionFailures(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &FQDNNetworkPolicyReconciler{Recorder: recorder}
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	fqdnNetworkPolicy.Status.FQDNs = []networkingv1alpha3.FQDNStatus{
+		{FQDN: "github.com", LastError: "A: i/o timeout"},
+		{FQDN: "gitlab.com", LastError: "A: i/o timeout"},
+	}
+	// gitlab.com was already failing
+	previous := []networkingv1alpha3.FQDNStatus{{FQDN: "gitlab.com", LastError: "A: SERVFAIL"}}
+	r.recordResolutionFailures(&fqdnNetworkPolicy, previous)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if e := <-recorder.Events; e != "Warning ResolutionFailed Unable to resolve github.com: A: i/o timeout" {
+		t.Errorf("unexpected event %q", e)
+	}
+}
+
+// expectGarbageCollected deletes the FQDNNetworkPolicy and checks that its
+// NetworkPolicy will be deleted by the garbage collector, which doesn't run
+// in the test environment.
+func expectGarbageCollected(ctx context.Context, fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy,
+	nn types.NamespacedName) {
+	Expect(k8sClient.Get(ctx, nn, fqdnNetworkPolicy)).Should(Succeed())
+	Expect(k8sClient.Delete(ctx, fqdnNetworkPolicy)).Should(Succeed())
+	// the finalizer is removed once the NetworkPolicy is taken care of
+	Eventually(func() error {
+		return k8sClient.Get(ctx, nn, &networkingv1alpha3.FQDNNetworkPolicy{})
+	}).ShouldNot(Succeed())
+	networkPolicy := networking.NetworkPolicy{}
+	Expect(k8sClient.Get(ctx, nn, &networkPolicy)).Should(Succeed())
+	Expect(metav1.IsControlledBy(&networkPolicy, fqdnNetworkPolicy)).Should(BeTrue())
+	Expect(k8sClient.Delete(ctx, &networkPolicy)).Should(Succeed())
+}
+
 func getFQDNNetworkPolicy(name string, namespace string) networkingv1alpha3.FQDNNetworkPolicy {
 	fqdnNetworkPolicy := networkingv1alpha3.FQDNNetworkPolicy{}
 	fqdnNetworkPolicy.GetValidResource()
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+// fqdnSetRefKey indexes the FQDNNetworkPolicies by the FQDNSets and
+// ClusterFQDNSets they reference, as returned by fqdnSetKey
+var fqdnSetRefKey = ".spec.fqdnSetRef"
+
+// fqdnSetKey identifies the set of kind named name, in namespace for a
+// FQDNSet
+func fqdnSetKey(kind string, namespace string, name string) string {
+	if kind == networkingv1alpha3.ClusterFQDNSetKind {
+		return kind + "/" + name
+	}
+	return networkingv1alpha3.FQDNSetKind + "/" + namespace + "/" + name
+}
+
+// fqdnSetRefs returns the keys of the sets referenced by the peers of the
+// FQDNNetworkPolicy, for the fqdnSetRefKey index
+func fqdnSetRefs(o client.Object) []string {
+	fqdnNetworkPolicy, ok := o.(*networkingv1alpha3.FQDNNetworkPolicy)
+	if !ok {
+		return nil
+	}
+	keys := []string{}
+	seen := map[string]bool{}
+	add := func(peers []networkingv1alpha3.FQDNNetworkPolicyPeer) {
+		for _, peer := range peers {
+			if peer.FQDNSetRef == nil {
+				continue
+			}
+			key := fqdnSetKey(peer.FQDNSetRef.Kind, fqdnNetworkPolicy.Namespace, peer.FQDNSetRef.Name)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, rule := range fqdnNetworkPolicy.Spec.Egress {
+		add(rule.To)
+	}
+	for _, rule := range fqdnNetworkPolicy.Spec.Ingress {
+		add(rule.From)
+	}
+	return keys
+}
+
+// expandFQDNSets adds the FQDNs of the sets referenced by the peers of the
+// FQDNNetworkPolicy to the FQDNs of these peers, so that they are resolved
+// along with them. It fails if a set doesn't exist.
+func (r *FQDNNetworkPolicyReconciler) expandFQDNSets(ctx context.Context,
+	fqdnNetworkPolicy *networkingv1alpha3.FQDNNetworkPolicy) error {
+	sets := map[string][]string{}
+	expand := func(peers []networkingv1alpha3.FQDNNetworkPolicyPeer) error {
+		for i := range peers {
+			ref := peers[i].FQDNSetRef
+			if ref == nil {
+				continue
+			}
+			key := fqdnSetKey(ref.Kind, fqdnNetworkPolicy.Namespace, ref.Name)
+			fqdns, ok := sets[key]
+			if !ok {
+				var err error
+				fqdns, err = r.getFQDNSet(ctx, fqdnNetworkPolicy.Namespace, ref)
+				if err != nil {
+					return err
+				}
+				sets[key] = fqdns
+			}
+			peers[i].FQDNs = mergeFQDNs(peers[i].FQDNs, fqdns)
+		}
+		return nil
+	}
+	for _, rule := range fqdnNetworkPolicy.Spec.Egress {
+		if err := expand(rule.To); err != nil {
+			return err
+		}
+	}
+	for _, rule := range fqdnNetworkPolicy.Spec.Ingress {
+		if err := expand(rule.From); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFQDNSet returns the FQDNs of the set referenced by ref, looking for a
+// FQDNSet in namespace
+func (r *FQDNNetworkPolicyReconciler) getFQDNSet(ctx context.Context, namespace string,
+	ref *networkingv1alpha3.FQDNSetReference) ([]string, error) {
+	if ref.Kind == networkingv1alpha3.ClusterFQDNSetKind {
+		set := &networkingv1alpha3.ClusterFQDNSet{}
+		if err := r.Get(ctx, client.ObjectKey{Name: ref.Name}, set); err != nil {
+			return nil, fmt.Errorf("unable to get ClusterFQDNSet %s: %w", ref.Name, err)
+		}
+		return set.Spec.FQDNs, nil
+	}
+	set := &networkingv1alpha3.FQDNSet{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, set); err != nil {
+		return nil, fmt.Errorf("unable to get FQDNSet %s: %w", ref.Name, err)
+	}
+	return set.Spec.FQDNs, nil
+}
+
+// mergeFQDNs returns fqdns followed by the FQDNs of more it doesn't contain
+func mergeFQDNs(fqdns []string, more []string) []string {
+	merged := append([]string{}, fqdns...)
+	for _, f := range more {
+		if !containsString(merged, f) {
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
+
+// fqdnSetRequests returns a request for every FQDNNetworkPolicy referencing
+// the FQDNSet or ClusterFQDNSet, so that they are updated when it changes
+func (r *FQDNNetworkPolicyReconciler) fqdnSetRequests(ctx context.Context, set client.Object) []reconcile.Request {
+	kind := networkingv1alpha3.FQDNSetKind
+	if _, ok := set.(*networkingv1alpha3.ClusterFQDNSet); ok {
+		kind = networkingv1alpha3.ClusterFQDNSetKind
+	}
+	fqdnNetworkPolicies := &networkingv1alpha3.FQDNNetworkPolicyList{}
+	if err := r.List(ctx, fqdnNetworkPolicies, client.MatchingFields{
+		fqdnSetRefKey: fqdnSetKey(kind, set.GetNamespace(), set.GetName())}); err != nil {
+		r.Log.Error(err, "unable to list the FQDNNetworkPolicies referencing "+kind+" "+set.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(fqdnNetworkPolicies.Items))
+	for _, fqdnNetworkPolicy := range fqdnNetworkPolicies.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&fqdnNetworkPolicy)})
+	}
+	return requests
+}
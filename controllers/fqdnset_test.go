@@ -0,0 +1,128 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	"github.com/miekg/dns"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FQDNSets", func() {
+	SetDefaultEventuallyTimeout(TIMEOUT)
+	SetDefaultEventuallyPollingInterval(POLLINTERVAL)
+
+	Context("when a FQDNNetworkPolicy references a FQDNSet", func() {
+		ctx := context.Background()
+		set := networkingv1alpha3.FQDNSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "fqdnset1", Namespace: "default"},
+			Spec:       networkingv1alpha3.FQDNSetSpec{FQDNs: []string{"github.com"}},
+		}
+		fqdnNetworkPolicy := getFQDNNetworkPolicy("fqdnset1", "default")
+		fqdnNetworkPolicy.Spec.Egress[0].To = []networkingv1alpha3.FQDNNetworkPolicyPeer{
+			{FQDNSetRef: &networkingv1alpha3.FQDNSetReference{Name: set.Name}}}
+		nn := types.NamespacedName{Namespace: fqdnNetworkPolicy.Namespace, Name: fqdnNetworkPolicy.Name}
+		// cidrs returns the CIDRs of the egress rules of the NetworkPolicy
+		cidrs := func() ([]string, error) {
+			networkPolicy := networking.NetworkPolicy{}
+			if err := k8sClient.Get(ctx, nn, &networkPolicy); err != nil {
+				return nil, err
+			}
+			cidrs := []string{}
+			for _, rule := range networkPolicy.Spec.Egress {
+				for _, to := range rule.To {
+					cidrs = append(cidrs, to.IPBlock.CIDR)
+				}
+			}
+			return cidrs, nil
+		}
+		It("Should allow the addresses of the FQDNs of the set", func() {
+			Expect(k8sClient.Create(ctx, &set)).Should(Succeed())
+			Expect(k8sClient.Create(ctx, &fqdnNetworkPolicy)).Should(Succeed())
+			Eventually(cidrs).Should(ConsistOf(fakeDNS.cidrs("github.com", dns.TypeA)))
+		})
+		It("Should update the NetworkPolicy when the set changes", func() {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&set), &set)).Should(Succeed())
+			set.Spec.FQDNs = []string{"gitlab.com"}
+			Expect(k8sClient.Update(ctx, &set)).Should(Succeed())
+			expected := append(fakeDNS.cidrs("gitlab.com", dns.TypeA), fakeDNS.cidrs("gitlab.com", dns.TypeAAAA)...)
+			Eventually(cidrs).Should(ConsistOf(expected))
+		})
+		It("Should keep the NetworkPolicy and stop being Ready when the set is deleted", func() {
+			Expect(k8sClient.Delete(ctx, &set)).Should(Succeed())
+			Eventually(func() error {
+				f := networkingv1alpha3.FQDNNetworkPolicy{}
+				if err := k8sClient.Get(ctx, nn, &f); err != nil {
+					return err
+				}
+				if !meta.IsStatusConditionFalse(f.Status.Conditions, networkingv1alpha3.ReadyCondition) {
+					return fmt.Errorf("FQDNNetworkPolicy is still Ready: %v", f.Status.Conditions)
+				}
+				return nil
+			}).Should(Succeed())
+			Expect(cidrs()).Should(ConsistOf(append(fakeDNS.cidrs("gitlab.com", dns.TypeA),
+				fakeDNS.cidrs("gitlab.com", dns.TypeAAAA)...)))
+			expectGarbageCollected(ctx, &fqdnNetworkPolicy, nn)
+		})
+	})
+})
+
+func TestFQDNSetRefs(t *testing.T) {
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	ref := func(kind string, name string) networkingv1alpha3.FQDNNetworkPolicyPeer {
+		return networkingv1alpha3.FQDNNetworkPolicyPeer{
+			FQDNSetRef: &networkingv1alpha3.FQDNSetReference{Kind: kind, Name: name}}
+	}
+	fqdnNetworkPolicy.Spec.Egress[0].To = append(fqdnNetworkPolicy.Spec.Egress[0].To,
+		ref("", "saas"), ref(networkingv1alpha3.FQDNSetKind, "saas"),
+		ref(networkingv1alpha3.ClusterFQDNSetKind, "saas"))
+	fqdnNetworkPolicy.Spec.Ingress = []networkingv1alpha3.FQDNNetworkPolicyIngressRule{
+		{From: []networkingv1alpha3.FQDNNetworkPolicyPeer{ref("", "partners")}}}
+
+	expected := []string{"FQDNSet/default/saas", "ClusterFQDNSet/saas", "FQDNSet/default/partners"}
+	if keys := fqdnSetRefs(&fqdnNetworkPolicy); !equality.Semantic.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+	if keys := fqdnSetRefs(&networking.NetworkPolicy{}); keys != nil {
+		t.Errorf("expected no keys for a NetworkPolicy, got %v", keys)
+	}
+}
+
+func TestMergeFQDNs(t *testing.T) {
+	fqdns := []string{"github.com"}
+	merged := mergeFQDNs(fqdns, []string{"gitlab.com", "github.com", "bitbucket.org"})
+	expected := []string{"github.com", "gitlab.com", "bitbucket.org"}
+	if !equality.Semantic.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+	if len(fqdns) != 1 {
+		t.Errorf("the FQDNs of the peer were changed: %v", fqdns)
+	}
+}
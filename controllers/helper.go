@@ -16,12 +16,6 @@ limitations under the License.
 
 package controllers
 
-import (
-	"bufio"
-	"os"
-	"strings"
-)
-
 // Helper function to check string exists in a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -43,30 +37,15 @@ func removeString(slice []string, s string) (result []string) {
 	return
 }
 
-// Helper function to get the nameservers from /etc/resolv.conf
-func getNameservers() (nameservers []string, err error) {
-	f, err := os.Open("/etc/resolv.conf")
-	if err != nil {
-		return nil, err
+// Helper function to check that two slices of strings are equal
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	defer f.Close()
-
-	nameservers = make([]string, 0)
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			continue
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-
-		parts := strings.Split(line, " ")
-		if parts[0] != "nameserver" {
-			continue
-		}
-
-		n := strings.Join(parts[1:], "")
-		n = strings.TrimSpace(n)
-		nameservers = append(nameservers, n)
 	}
-	return nameservers, nil
+	return true
 }
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+const metricsNamespace = "fqdnnetworkpolicies"
+
+var (
+	dnsCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dns_cache_hits_total",
+		Help:      "Number of DNS lookups answered from the cache, or by waiting for the same lookup in flight.",
+	})
+	dnsCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dns_cache_misses_total",
+		Help:      "Number of DNS lookups that had to be sent to the nameservers.",
+	})
+	dnsCacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dns_cache_entries",
+		Help:      "Number of FQDN and record type pairs in the DNS cache.",
+	})
+	dnsQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "dns_query_duration_seconds",
+		Help:      "Time taken by the nameservers to answer DNS queries.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"record_type", "nameserver"})
+	dnsQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dns_queries_total",
+		Help:      "Number of DNS queries sent to the nameservers, by response code, or timeout or error if there was no response.",
+	}, []string{"record_type", "nameserver", "rcode"})
+	policyAddresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "resolved_addresses",
+		Help:      "Number of CIDRs in the NetworkPolicy of a FQDNNetworkPolicy.",
+	}, []string{"namespace", "name"})
+	policiesByState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "policies",
+		Help:      "Number of FQDNNetworkPolicies by state.",
+	}, []string{"state"})
+	networkPolicyWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "networkpolicy_writes_total",
+		Help:      "Number of writes of NetworkPolicies to the API server, by operation and result.",
+	}, []string{"operation", "result"})
+	policyLastSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_successful_sync_timestamp_seconds",
+		Help:      "Time of the last successful sync of the NetworkPolicy of a FQDNNetworkPolicy, in seconds since the epoch.",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	// Registering the metrics on the controller-runtime registry,
+	// so that they are exposed on the metrics endpoint of the manager.
+	metrics.Registry.MustRegister(dnsCacheHits, dnsCacheMisses, dnsCacheEntries,
+		dnsQueryDuration, dnsQueries, policyAddresses, policiesByState, networkPolicyWrites, policyLastSync)
+}
+
+// observeDNSQuery records the duration and the outcome of a DNS query
+func observeDNSQuery(recordType uint16, nameserver string, d time.Duration, r *dns.Msg, err error) {
+	recordTypeLabel := dns.TypeToString[recordType]
+	dnsQueryDuration.WithLabelValues(recordTypeLabel, nameserver).Observe(d.Seconds())
+	rcode := "error"
+	switch {
+	case err == nil:
+		rcode = dns.RcodeToString[r.Rcode]
+	case isTimeout(err):
+		rcode = "timeout"
+	}
+	dnsQueries.WithLabelValues(recordTypeLabel, nameserver, rcode).Inc()
+}
+
+// countNetworkPolicyWrite records the result of a write of a NetworkPolicy
+func countNetworkPolicyWrite(operation string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	networkPolicyWrites.WithLabelValues(operation, result).Inc()
+}
+
+// policyStates holds the state of each FQDNNetworkPolicy, to maintain
+// the policiesByState metric
+var policyStates = struct {
+	sync.Mutex
+	states map[types.NamespacedName]networkingv1alpha3.State
+}{states: map[types.NamespacedName]networkingv1alpha3.State{}}
+
+// setPolicyStateMetric records the state of a FQDNNetworkPolicy in the
+// policiesByState metric
+func setPolicyStateMetric(nn types.NamespacedName, state networkingv1alpha3.State) {
+	policyStates.Lock()
+	defer policyStates.Unlock()
+	if previous, ok := policyStates.states[nn]; ok {
+		policiesByState.WithLabelValues(string(previous)).Dec()
+	}
+	policyStates.states[nn] = state
+	policiesByState.WithLabelValues(string(state)).Inc()
+}
+
+// deletePolicyMetrics removes a FQDNNetworkPolicy that doesn't exist
+// anymore from the metrics
+func deletePolicyMetrics(nn types.NamespacedName) {
+	policyStates.Lock()
+	defer policyStates.Unlock()
+	if previous, ok := policyStates.states[nn]; ok {
+		policiesByState.WithLabelValues(string(previous)).Dec()
+		delete(policyStates.states, nn)
+	}
+	policyAddresses.DeleteLabelValues(nn.Namespace, nn.Name)
+	policyLastSync.DeleteLabelValues(nn.Namespace, nn.Name)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+func TestObserveDNSQuery(t *testing.T) {
+	noError := dnsQueries.WithLabelValues("A", "192.0.2.53", "NOERROR")
+	servfail := dnsQueries.WithLabelValues("A", "192.0.2.53", "SERVFAIL")
+	timeout := dnsQueries.WithLabelValues("A", "192.0.2.53", "timeout")
+	before := []float64{testutil.ToFloat64(noError), testutil.ToFloat64(servfail), testutil.ToFloat64(timeout)}
+
+	r := new(dns.Msg)
+	observeDNSQuery(dns.TypeA, "192.0.2.53", time.Millisecond, r, nil)
+	r.Rcode = dns.RcodeServerFailure
+	observeDNSQuery(dns.TypeA, "192.0.2.53", time.Millisecond, r, nil)
+	observeDNSQuery(dns.TypeA, "192.0.2.53", time.Second, nil, context.DeadlineExceeded)
+	observeDNSQuery(dns.TypeA, "192.0.2.53", time.Second, nil, errors.New("connection refused"))
+
+	for i, c := range []float64{testutil.ToFloat64(noError), testutil.ToFloat64(servfail), testutil.ToFloat64(timeout)} {
+		if c != before[i]+1 {
+			t.Errorf("expected counter %d to be incremented, got %v from %v", i, c, before[i])
+		}
+	}
+	if c := testutil.ToFloat64(dnsQueries.WithLabelValues("A", "192.0.2.53", "error")); c < 1 {
+		t.Errorf("expected the error to be counted")
+	}
+}
+
+func TestPolicyStateMetric(t *testing.T) {
+	nn := types.NamespacedName{Namespace: "default", Name: "metrics"}
+	pending := policiesByState.WithLabelValues(string(networkingv1alpha3.PendingState))
+	active := policiesByState.WithLabelValues(string(networkingv1alpha3.ActiveState))
+	pendingBefore, activeBefore := testutil.ToFloat64(pending), testutil.ToFloat64(active)
+
+	setPolicyStateMetric(nn, networkingv1alpha3.PendingState)
+	setPolicyStateMetric(nn, networkingv1alpha3.ActiveState)
+	setPolicyStateMetric(nn, networkingv1alpha3.ActiveState)
+	if testutil.ToFloat64(pending) != pendingBefore || testutil.ToFloat64(active) != activeBefore+1 {
+		t.Errorf("expected the FQDNNetworkPolicy to be counted once as Active")
+	}
+
+	deletePolicyMetrics(nn)
+	if testutil.ToFloat64(active) != activeBefore {
+		t.Errorf("expected the FQDNNetworkPolicy not to be counted anymore")
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolvConf holds the parts of a resolv.conf(5) file used by the DNSResolver
+type resolvConf struct {
+	nameservers []string
+	search      []string
+	// ndots is the number of dots a name needs to have to be
+	// tried as an absolute name before going through the search list
+	ndots int
+	// timeout is how long to wait for an answer from a nameserver
+	timeout time.Duration
+	// attempts is how many times the whole list of nameservers is tried
+	attempts int
+	// rotate spreads the queries over the nameservers in a round-robin fashion
+	rotate bool
+}
+
+// readResolvConf parses the resolv.conf file at path
+func readResolvConf(path string) (*resolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseResolvConf(f)
+}
+
+// parseResolvConf parses a resolv.conf file. The defaults and limits
+// are the same as the ones of the glibc resolver.
+func parseResolvConf(r io.Reader) (*resolvConf, error) {
+	conf := &resolvConf{
+		nameservers: []string{},
+		search:      []string{},
+		ndots:       1,
+		timeout:     5 * time.Second,
+		attempts:    2,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) > 1 {
+				conf.nameservers = append(conf.nameservers, fields[1])
+			}
+		case "domain":
+			if len(fields) > 1 {
+				conf.search = []string{fields[1]}
+			}
+		case "search":
+			conf.search = append([]string{}, fields[1:]...)
+		case "options":
+			for _, option := range fields[1:] {
+				switch {
+				case option == "rotate":
+					conf.rotate = true
+				case strings.HasPrefix(option, "ndots:"):
+					if n, err := strconv.Atoi(strings.TrimPrefix(option, "ndots:")); err == nil && n >= 0 {
+						if n > 15 {
+							n = 15
+						}
+						conf.ndots = n
+					}
+				case strings.HasPrefix(option, "timeout:"):
+					if n, err := strconv.Atoi(strings.TrimPrefix(option, "timeout:")); err == nil && n >= 1 {
+						if n > 30 {
+							n = 30
+						}
+						conf.timeout = time.Duration(n) * time.Second
+					}
+				case strings.HasPrefix(option, "attempts:"):
+					if n, err := strconv.Atoi(strings.TrimPrefix(option, "attempts:")); err == nil && n >= 1 {
+						if n > 5 {
+							n = 5
+						}
+						conf.attempts = n
+					}
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// names returns the list of names to query, in order, for the provided
+// name. Names ending with a dot are absolute and queried as is. Other names
+// go through the search list, before or after being tried as absolute names
+// depending on their number of dots.
+func (c *resolvConf) names(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+
+	names := []string{}
+	absolute := c.absoluteFirst(name)
+	if absolute {
+		names = append(names, name+".")
+	}
+	for _, s := range c.search {
+		names = append(names, name+"."+strings.TrimSuffix(s, ".")+".")
+	}
+	if !absolute {
+		names = append(names, name+".")
+	}
+	return names
+}
+
+// absoluteFirst returns whether name is tried as an absolute name before
+// going through the search list, as it has at least ndots dots
+func (c *resolvConf) absoluteFirst(name string) bool {
+	return strings.HasSuffix(name, ".") || strings.Count(name, ".") >= c.ndots
+}
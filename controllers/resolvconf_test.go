@@ -0,0 +1,75 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	conf, err := parseResolvConf(strings.NewReader(`# comment
+; other comment
+nameserver 169.254.20.10
+nameserver  10.0.0.10
+search default.svc.cluster.local svc.cluster.local cluster.local
+options ndots:5 timeout:2 attempts:3 rotate
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.nameservers, []string{"169.254.20.10", "10.0.0.10"}) {
+		t.Errorf("unexpected nameservers: %v", conf.nameservers)
+	}
+	if len(conf.search) != 3 {
+		t.Errorf("unexpected search list: %v", conf.search)
+	}
+	if conf.ndots != 5 || conf.timeout != 2*time.Second || conf.attempts != 3 || !conf.rotate {
+		t.Errorf("unexpected options: %+v", conf)
+	}
+}
+
+func TestParseResolvConfDefaults(t *testing.T) {
+	conf, err := parseResolvConf(strings.NewReader("nameserver 10.0.0.10\noptions ndots:50 attempts:0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.ndots != 15 || conf.timeout != 5*time.Second || conf.attempts != 2 || conf.rotate {
+		t.Errorf("unexpected options: %+v", conf)
+	}
+}
+
+func TestResolvConfNames(t *testing.T) {
+	conf := &resolvConf{search: []string{"svc.cluster.local"}, ndots: 2}
+	if names := conf.names("example.com."); !reflect.DeepEqual(names, []string{"example.com."}) {
+		t.Errorf("absolute names shouldn't go through the search list, got %v", names)
+	}
+	if names := conf.names("example.com"); !reflect.DeepEqual(names,
+		[]string{"example.com.svc.cluster.local.", "example.com."}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if names := conf.names("kubernetes"); !reflect.DeepEqual(names,
+		[]string{"kubernetes.svc.cluster.local.", "kubernetes."}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if names := conf.names("www.example.com"); !reflect.DeepEqual(names,
+		[]string{"www.example.com.", "www.example.com.svc.cluster.local."}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
@@ -0,0 +1,427 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Resolver resolves FQDNs into the IP addresses used in the generated
+// NetworkPolicies.
+type Resolver interface {
+	// Resolve looks up the records of type recordType (dns.TypeA or
+	// dns.TypeAAAA) for fqdn, as written in the FQDNNetworkPolicy. Names
+	// ending with a dot are absolute.
+	// An FQDN that doesn't exist, or doesn't have records of that type, is
+	// not an error: it returns an empty Answer with the NXDOMAIN or NODATA
+	// Outcome. Only the lookups that got no authoritative answer, because
+	// of a timeout or a SERVFAIL for example, return an error.
+	Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error)
+}
+
+// Answer holds the addresses found for a single FQDN and record type.
+type Answer struct {
+	Addresses []Address
+	// CNAMEs is the chain of CNAME records followed to get to the
+	// addresses, in order.
+	CNAMEs []CNAME
+	// Nameserver is the nameserver that answered, if known
+	Nameserver string
+	// Outcome tells whether the FQDN exists and has records of the type
+	// looked up
+	Outcome Outcome
+	// NegativeTTL is how long the absence of records can be cached, from
+	// the SOA record of the negative answers. It's 0 if there is no SOA
+	// record, or if the answer has addresses.
+	NegativeTTL uint32
+}
+
+// Outcome is the classification of an answer
+type Outcome string
+
+// The outcomes of the lookups that got an answer. The lookups that didn't
+// get one, because of a timeout or a SERVFAIL for example, return an error.
+const (
+	// OutcomeSuccess means that records were found
+	OutcomeSuccess Outcome = "Success"
+	// OutcomeNXDomain means that the FQDN doesn't exist
+	OutcomeNXDomain Outcome = "NXDOMAIN"
+	// OutcomeNoData means that the FQDN exists, but doesn't have records of
+	// the type looked up
+	OutcomeNoData Outcome = "NODATA"
+)
+
+// RcodeError is returned when all the nameservers answered with a response
+// code meaning that they couldn't answer, such as SERVFAIL or REFUSED.
+type RcodeError struct {
+	Nameserver string
+	Name       string
+	Rcode      int
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("nameserver %s answered %s for %s", e.Nameserver, dns.RcodeToString[e.Rcode], e.Name)
+}
+
+// classify returns the outcome of a lookup: the Outcome of its answer, the
+// response code of a RcodeError, "timeout", or "error" for other errors.
+func classify(answer *Answer, err error) string {
+	var rcodeErr *RcodeError
+	switch {
+	case err == nil:
+		return string(answer.Outcome)
+	case errors.As(err, &rcodeErr):
+		return dns.RcodeToString[rcodeErr.Rcode]
+	case isTimeout(err):
+		return "timeout"
+	}
+	return "error"
+}
+
+// isTimeout returns whether err is a timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// CNAME is a CNAME record pointing Name to Target.
+type CNAME struct {
+	Name   string
+	Target string
+	TTL    uint32
+}
+
+// MinTTL returns the lowest TTL of the records of the answer, including the
+// CNAME records and the negative TTL, or max if it's lower.
+func (a *Answer) MinTTL(max uint32) uint32 {
+	ttl := max
+	if len(a.Addresses) == 0 && a.NegativeTTL > 0 && a.NegativeTTL < ttl {
+		ttl = a.NegativeTTL
+	}
+	for _, address := range a.Addresses {
+		if address.TTL < ttl {
+			ttl = address.TTL
+		}
+	}
+	for _, cname := range a.CNAMEs {
+		if cname.TTL < ttl {
+			ttl = cname.TTL
+		}
+	}
+	return ttl
+}
+
+// Address is an IP address along with the TTL of the record it came from.
+type Address struct {
+	IP  net.IP
+	TTL uint32
+}
+
+// query is a lookup of a FQDN for a record type
+type query struct {
+	fqdn       string
+	recordType uint16
+}
+
+// result is the outcome of a query
+type result struct {
+	answer *Answer
+	err    error
+}
+
+// resolveAll runs the provided queries against resolver, with at most
+// parallelism queries in flight at the same time. Each query is given
+// timeout to complete.
+func resolveAll(ctx context.Context, resolver Resolver, queries []query,
+	parallelism int, timeout time.Duration) map[query]result {
+	results := make(map[query]result, len(queries))
+	seen := make(map[query]bool, len(queries))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+	for _, q := range queries {
+		if seen[q] {
+			// The same FQDN can appear in several rules
+			continue
+		}
+		seen[q] = true
+		wg.Add(1)
+		go func(q query) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			qctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				qctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			answer, err := resolver.Resolve(qctx, q.fqdn, q.recordType)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[q] = result{answer: answer, err: err}
+		}(q)
+	}
+	wg.Wait()
+	return results
+}
+
+// DNSResolver is the default Resolver. It queries the nameservers listed
+// in a resolv.conf file, following the options set in that file:
+// the nameservers are tried in order (or in a round-robin fashion if the
+// rotate option is set) until one of them answers, relative names go through
+// the search list, and the timeout and attempts options are honored.
+type DNSResolver struct {
+	// ResolvConf is the path to the resolv.conf file to read the nameservers
+	// from. Defaults to /etc/resolv.conf.
+	ResolvConf string
+	// Port is the port the nameservers listen on. Defaults to 53.
+	Port string
+	// MaxCNAMEDepth is the maximum number of CNAME records followed
+	// to resolve a FQDN. Defaults to 8.
+	MaxCNAMEDepth int
+
+	// next is the index of the nameserver to start with when the rotate
+	// option is set
+	next atomic.Uint32
+}
+
+var _ Resolver = &DNSResolver{}
+
+// defaultMaxCNAMEDepth is the default value of DNSResolver.MaxCNAMEDepth
+const defaultMaxCNAMEDepth = 8
+
+// ednsBufferSize is the UDP buffer size advertised in the queries, as
+// recommended by the DNS flag day 2020 to avoid IP fragmentation.
+const ednsBufferSize = 1232
+
+// Resolve implements Resolver
+func (d *DNSResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	path := d.ResolvConf
+	if path == "" {
+		path = "/etc/resolv.conf"
+	}
+	// The resolv.conf file is read on every query so that
+	// changes to it are picked up without restarting the controller.
+	conf, err := readResolvConf(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.nameservers) == 0 {
+		return nil, errors.New("no nameserver found in " + path)
+	}
+
+	// Like the glibc resolver, the next names are tried when a name fails to
+	// resolve, and only the last error is returned if none has addresses.
+	var answer *Answer
+	var lastErr error
+	absoluteFirst := conf.absoluteFirst(fqdn)
+	for _, name := range conf.names(fqdn) {
+		a, err := d.resolveName(ctx, conf, name, recordType)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if len(a.Addresses) > 0 {
+			return a, nil
+		}
+		// The authoritative answer for the absolute name is final, a
+		// wildcard record of a search domain can't answer in its place
+		if absoluteFirst && lastErr == nil {
+			return a, nil
+		}
+		// A name that exists takes precedence over the ones that don't
+		if answer == nil || (a.Outcome == OutcomeNoData && answer.Outcome != OutcomeNoData) {
+			answer = a
+		}
+	}
+	// A negative answer is only authoritative if no name failed to resolve
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return answer, nil
+}
+
+// resolveName resolves an absolute name, following the CNAME chain if the
+// nameserver didn't follow it all the way to the addresses.
+func (d *DNSResolver) resolveName(ctx context.Context, conf *resolvConf, name string, recordType uint16) (*Answer, error) {
+	maxDepth := d.MaxCNAMEDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxCNAMEDepth
+	}
+
+	answer := &Answer{}
+	seen := map[string]bool{strings.ToLower(name): true}
+	current := name
+	for {
+		r, ns, err := d.exchange(ctx, conf, current, recordType)
+		if err != nil {
+			return nil, err
+		}
+		answer.Nameserver = ns
+
+		// Following the CNAME records included in the answer
+		for {
+			cname := findCNAME(r, current)
+			if cname == nil {
+				break
+			}
+			if seen[strings.ToLower(cname.Target)] {
+				return nil, fmt.Errorf("CNAME loop detected for %s: %s points back to %s", name, current, cname.Target)
+			}
+			if len(answer.CNAMEs) >= maxDepth {
+				return nil, fmt.Errorf("CNAME chain for %s is longer than %d", name, maxDepth)
+			}
+			seen[strings.ToLower(cname.Target)] = true
+			answer.CNAMEs = append(answer.CNAMEs, *cname)
+			current = cname.Target
+		}
+
+		answer.Addresses = addressesFromMsg(r, current, recordType)
+		answer.Outcome, answer.NegativeTTL = OutcomeSuccess, 0
+		switch {
+		case len(answer.Addresses) > 0:
+			return answer, nil
+		case r.Rcode == dns.RcodeNameError:
+			answer.Outcome, answer.NegativeTTL = OutcomeNXDomain, negativeTTL(r)
+			return answer, nil
+		}
+		// If the answer ends with a CNAME whose target hasn't been resolved
+		// by the nameserver, we need to resolve it ourselves.
+		if len(answer.CNAMEs) == 0 || findCNAME(r, answer.CNAMEs[len(answer.CNAMEs)-1].Name) == nil {
+			answer.Outcome, answer.NegativeTTL = OutcomeNoData, negativeTTL(r)
+			return answer, nil
+		}
+	}
+}
+
+// exchange sends a query for name to the nameservers of conf until one of
+// them answers, and returns that answer along with the nameserver. Only when
+// all the nameservers failed for all the attempts an error is returned.
+func (d *DNSResolver) exchange(ctx context.Context, conf *resolvConf, name string, recordType uint16) (*dns.Msg, string, error) {
+	port := d.Port
+	if port == "" {
+		port = "53"
+	}
+
+	c := new(dns.Client)
+	c.SingleInflight = true
+	c.Timeout = conf.timeout
+	m := new(dns.Msg)
+	m.SetQuestion(name, recordType)
+	// Advertising a larger buffer size so that most answers fit in
+	// a single UDP response.
+	m.SetEdns0(ednsBufferSize, false)
+
+	start := 0
+	if conf.rotate {
+		start = int(d.next.Add(1)-1) % len(conf.nameservers)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < conf.attempts; attempt++ {
+		for i := range conf.nameservers {
+			ns := conf.nameservers[(start+i)%len(conf.nameservers)]
+			began := time.Now()
+			r, _, err := c.ExchangeContext(ctx, m, net.JoinHostPort(ns, port))
+			if err == nil && r.Truncated {
+				// The answer didn't fit in a UDP response, we need to retry over TCP
+				// to get the complete list of addresses.
+				tc := new(dns.Client)
+				tc.Net = "tcp"
+				tc.Timeout = conf.timeout
+				r, _, err = tc.ExchangeContext(ctx, m, net.JoinHostPort(ns, port))
+			}
+			observeDNSQuery(recordType, ns, time.Since(began), r, err)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, "", ctx.Err()
+				}
+				lastErr = err
+				continue
+			}
+			// A SERVFAIL or REFUSED means that this nameserver can't answer,
+			// but another one may, unlike a NXDOMAIN.
+			if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+				lastErr = &RcodeError{Nameserver: ns, Name: name, Rcode: r.Rcode}
+				continue
+			}
+			return r, ns, nil
+		}
+	}
+	return nil, "", lastErr
+}
+
+// findCNAME returns the CNAME record for name found in r, if any
+func findCNAME(r *dns.Msg, name string) *CNAME {
+	for _, ans := range r.Answer {
+		if t, ok := ans.(*dns.CNAME); ok && strings.EqualFold(t.Hdr.Name, name) {
+			return &CNAME{Name: t.Hdr.Name, Target: t.Target, TTL: t.Hdr.Ttl}
+		}
+	}
+	return nil
+}
+
+// negativeTTL returns how long the negative answer r can be cached: the
+// lowest of the TTL of the SOA record in its authority section and of its
+// MINIMUM field, as defined by RFC 2308. It's 0 without SOA record.
+func negativeTTL(r *dns.Msg) uint32 {
+	for _, ns := range r.Ns {
+		if soa, ok := ns.(*dns.SOA); ok {
+			if soa.Minttl < soa.Hdr.Ttl {
+				return soa.Minttl
+			}
+			return soa.Hdr.Ttl
+		}
+	}
+	return 0
+}
+
+// addressesFromMsg returns the addresses of type recordType for name found in r
+func addressesFromMsg(r *dns.Msg, name string, recordType uint16) []Address {
+	addresses := []Address{}
+	for _, ans := range r.Answer {
+		if !strings.EqualFold(ans.Header().Name, name) {
+			continue
+		}
+		switch t := ans.(type) {
+		case *dns.A:
+			if recordType == dns.TypeA {
+				addresses = append(addresses, Address{IP: t.A, TTL: t.Hdr.Ttl})
+			}
+		case *dns.AAAA:
+			if recordType == dns.TypeAAAA {
+				addresses = append(addresses, Address{IP: t.AAAA, TTL: t.Hdr.Ttl})
+			}
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,599 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeZone contains the records served by the fake DNS server used in tests
+var fakeZone = []string{
+	"github.com. 60 IN A 140.82.121.3",
+	"github.com. 60 IN A 140.82.121.4",
+	"gitlab.com. 30 IN A 172.65.251.78",
+	"gitlab.com. 30 IN AAAA 2606:4700:90:0:f22e:fbec:5bed:a9b9",
+}
+
+// fakeDNSServer is an in-process DNS server answering from a static zone
+type fakeDNSServer struct {
+	server    *dns.Server
+	tcpServer *dns.Server
+	addr      string
+
+	mu      sync.Mutex
+	records map[string][]dns.RR
+	// rcode, when set, is returned for every query instead of the records
+	rcode int
+	// queries is the number of queries received
+	queries int
+	// flatten makes the server follow CNAME records in its answers,
+	// like a recursive resolver would
+	flatten bool
+	// soa, when set, is added to the authority section of negative answers
+	soa dns.RR
+	// dropped are the names whose queries are never answered
+	dropped map[string]bool
+}
+
+// startFakeDNSServer starts a fakeDNSServer listening on addr (UDP and TCP),
+// serving the provided records.
+func startFakeDNSServer(addr string, zone []string) (*fakeDNSServer, error) {
+	f := &fakeDNSServer{records: map[string][]dns.RR{}, dropped: map[string]bool{}}
+	for _, z := range zone {
+		if err := f.add(z); err != nil {
+			return nil, err
+		}
+	}
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	f.addr = pc.LocalAddr().String()
+	started := make(chan struct{})
+	f.server = &dns.Server{
+		PacketConn:        pc,
+		Handler:           f,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go f.server.ActivateAndServe()
+	<-started
+
+	l, err := net.Listen("tcp", f.addr)
+	if err != nil {
+		f.server.Shutdown()
+		return nil, err
+	}
+	tcpStarted := make(chan struct{})
+	f.tcpServer = &dns.Server{
+		Listener:          l,
+		Handler:           f,
+		NotifyStartedFunc: func() { close(tcpStarted) },
+	}
+	go f.tcpServer.ActivateAndServe()
+	<-tcpStarted
+	return f, nil
+}
+
+// add adds a record, in zone file format, to the zone
+func (f *fakeDNSServer) add(record string) error {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := strings.ToLower(rr.Header().Name)
+	f.records[name] = append(f.records[name], rr)
+	return nil
+}
+
+// remove removes the records of name from the zone, so that it doesn't exist
+// anymore
+func (f *fakeDNSServer) remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.records, dns.Fqdn(strings.ToLower(name)))
+}
+
+// drop makes the server ignore the queries for name, or answer them again
+func (f *fakeDNSServer) drop(name string, dropped bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dropped[dns.Fqdn(strings.ToLower(name))] = dropped
+}
+
+// ServeDNS implements dns.Handler
+func (f *fakeDNSServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	if f.dropped[strings.ToLower(req.Question[0].Name)] {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetReply(req)
+	if f.rcode != dns.RcodeSuccess {
+		m.Rcode = f.rcode
+		w.WriteMsg(m)
+		return
+	}
+	q := req.Question[0]
+	name := strings.ToLower(q.Name)
+	if _, ok := f.records[name]; !ok {
+		m.Rcode = dns.RcodeNameError
+	}
+	for i := 0; i < 16; i++ {
+		var cname *dns.CNAME
+		for _, rr := range f.records[name] {
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			} else if t, ok := rr.(*dns.CNAME); ok {
+				cname = t
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		if cname == nil || !f.flatten {
+			break
+		}
+		name = strings.ToLower(cname.Target)
+	}
+	if len(m.Answer) == 0 && f.soa != nil {
+		m.Ns = append(m.Ns, f.soa)
+	}
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		// Truncating UDP answers to the buffer size of the client
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		m.Truncate(size)
+	}
+	w.WriteMsg(m)
+}
+
+// cidrs returns the CIDRs expected in a NetworkPolicy for the provided FQDN
+func (f *fakeDNSServer) cidrs(fqdn string, recordType uint16) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cidrs := []string{}
+	for _, rr := range f.records[dns.Fqdn(strings.ToLower(fqdn))] {
+		switch t := rr.(type) {
+		case *dns.A:
+			if recordType == dns.TypeA {
+				cidrs = append(cidrs, t.A.String()+"/32")
+			}
+		case *dns.AAAA:
+			if recordType == dns.TypeAAAA {
+				cidrs = append(cidrs, t.AAAA.String()+"/128")
+			}
+		}
+	}
+	return cidrs
+}
+
+// resolver returns a DNSResolver querying the fake server, using a
+// resolv.conf file written in dir.
+func (f *fakeDNSServer) resolver(dir string) (*DNSResolver, error) {
+	host, port, err := net.SplitHostPort(f.addr)
+	if err != nil {
+		return nil, err
+	}
+	return newTestResolver(dir, port, "nameserver "+host)
+}
+
+// newTestResolver returns a DNSResolver querying port, using a resolv.conf
+// file written in dir with the provided lines.
+func newTestResolver(dir string, port string, lines ...string) (*DNSResolver, error) {
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	if err := os.WriteFile(resolvConf, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return &DNSResolver{ResolvConf: resolvConf, Port: port}, nil
+}
+
+// queryCount returns the number of queries received by the server
+func (f *fakeDNSServer) queryCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries
+}
+
+// setRcode makes the server answer every query with rcode
+func (f *fakeDNSServer) setRcode(rcode int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rcode = rcode
+}
+
+func (f *fakeDNSServer) stop() {
+	f.server.Shutdown()
+	f.tcpServer.Shutdown()
+}
+
+func TestDNSResolverResolve(t *testing.T) {
+	f, err := startFakeDNSServer("127.0.0.1:0", fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.stop()
+	d, err := f.resolver(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := d.Resolve(context.Background(), "github.com.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 2 {
+		t.Errorf("expected 2 A records for github.com, got %v", a.Addresses)
+	}
+	for _, address := range a.Addresses {
+		if address.TTL != 60 {
+			t.Errorf("expected a TTL of 60, got %d", address.TTL)
+		}
+	}
+
+	aaaa, err := d.Resolve(context.Background(), "gitlab.com.", dns.TypeAAAA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aaaa.Addresses) != 1 || aaaa.Addresses[0].IP.String() != "2606:4700:90:0:f22e:fbec:5bed:a9b9" {
+		t.Errorf("unexpected AAAA records for gitlab.com: %v", aaaa.Addresses)
+	}
+
+	nx, err := d.Resolve(context.Background(), "foo.bar.notld.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nx.Addresses) != 0 || nx.Outcome != OutcomeNXDomain || nx.NegativeTTL != 0 {
+		t.Errorf("expected a NXDOMAIN without negative TTL for a non-existent FQDN, got %+v", nx)
+	}
+}
+
+func TestDNSResolverNegativeAnswers(t *testing.T) {
+	f, err := startFakeDNSServer("127.0.0.1:0", fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.stop()
+	// the negative TTL is the lowest of the TTL and the MINIMUM of the SOA
+	soa, err := dns.NewRR(". 300 IN SOA a.root-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.soa = soa
+	f.mu.Unlock()
+	d, err := f.resolver(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		fqdn       string
+		recordType uint16
+		outcome    Outcome
+		ttl        uint32
+	}{
+		{"github.com.", dns.TypeA, OutcomeSuccess, 60},
+		{"foo.bar.notld.", dns.TypeA, OutcomeNXDomain, 300},
+		{"github.com.", dns.TypeAAAA, OutcomeNoData, 300},
+	} {
+		a, err := d.Resolve(context.Background(), tc.fqdn, tc.recordType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Outcome != tc.outcome || a.MinTTL(3600) != tc.ttl {
+			t.Errorf("expected %s with a TTL of %d for %s %s, got %s with %d", tc.outcome, tc.ttl,
+				dns.TypeToString[tc.recordType], tc.fqdn, a.Outcome, a.MinTTL(3600))
+		}
+		if got := classify(a, nil); got != string(tc.outcome) {
+			t.Errorf("unexpected classification %s", got)
+		}
+	}
+
+	f.setRcode(dns.RcodeServerFailure)
+	a, err := d.Resolve(context.Background(), "github.com.", dns.TypeA)
+	if err == nil {
+		t.Fatal("a SERVFAIL should be an error")
+	}
+	if got := classify(a, err); got != "SERVFAIL" {
+		t.Errorf("expected a SERVFAIL, got %s", got)
+	}
+	if got := classify(nil, context.DeadlineExceeded); got != "timeout" {
+		t.Errorf("expected a timeout, got %s", got)
+	}
+}
+
+func TestDNSResolverMissingResolvConf(t *testing.T) {
+	d := &DNSResolver{ResolvConf: filepath.Join(t.TempDir(), "resolv.conf")}
+	if _, err := d.Resolve(context.Background(), "github.com.", dns.TypeA); err == nil {
+		t.Error("resolving without a resolv.conf file should fail")
+	}
+}
+
+// startFakeDNSServerPair starts two fake DNS servers, on 127.0.0.1 and
+// 127.0.0.2, listening on the same port.
+func startFakeDNSServerPair(t *testing.T) (*fakeDNSServer, *fakeDNSServer, string) {
+	first, err := startFakeDNSServer("127.0.0.1:0", fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(first.stop)
+	_, port, _ := net.SplitHostPort(first.addr)
+	second, err := startFakeDNSServer("127.0.0.2:"+port, fakeZone)
+	if err != nil {
+		t.Skip("unable to listen on 127.0.0.2: " + err.Error())
+	}
+	t.Cleanup(second.stop)
+	return first, second, port
+}
+
+func TestDNSResolverFailover(t *testing.T) {
+	first, second, port := startFakeDNSServerPair(t)
+	d, err := newTestResolver(t.TempDir(), port,
+		"nameserver 127.0.0.1", "nameserver 127.0.0.2", "options timeout:1 attempts:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.setRcode(dns.RcodeServerFailure)
+	a, err := d.Resolve(context.Background(), "github.com.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 2 {
+		t.Errorf("expected the second nameserver to answer, got %v", a.Addresses)
+	}
+	if first.queryCount() != 1 || second.queryCount() != 1 {
+		t.Errorf("expected one query per nameserver, got %d and %d", first.queryCount(), second.queryCount())
+	}
+
+	second.setRcode(dns.RcodeRefused)
+	if _, err := d.Resolve(context.Background(), "github.com.", dns.TypeA); err == nil {
+		t.Error("resolving should fail when all the nameservers fail")
+	}
+}
+
+func TestDNSResolverRotate(t *testing.T) {
+	first, second, port := startFakeDNSServerPair(t)
+	d, err := newTestResolver(t.TempDir(), port,
+		"nameserver 127.0.0.1", "nameserver 127.0.0.2", "options rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := d.Resolve(context.Background(), "github.com.", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.queryCount() != 2 || second.queryCount() != 2 {
+		t.Errorf("expected queries to be spread over the nameservers, got %d and %d",
+			first.queryCount(), second.queryCount())
+	}
+}
+
+func TestDNSResolverSearch(t *testing.T) {
+	f, err := startFakeDNSServer("127.0.0.1:0", []string{
+		"api.svc.cluster.local. 30 IN A 10.0.0.10",
+		"api.example.com. 30 IN A 192.0.2.10",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.stop()
+	_, port, _ := net.SplitHostPort(f.addr)
+	d, err := newTestResolver(t.TempDir(), port,
+		"nameserver 127.0.0.1", "search svc.cluster.local", "options ndots:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no dot: the search list is tried first
+	a, err := d.Resolve(context.Background(), "api", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 1 || a.Addresses[0].IP.String() != "10.0.0.10" {
+		t.Errorf("unexpected answer for api: %v", a.Addresses)
+	}
+	// less dots than ndots: the name is tried as absolute after the search list
+	a, err = d.Resolve(context.Background(), "api.example.com", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 1 || a.Addresses[0].IP.String() != "192.0.2.10" {
+		t.Errorf("unexpected answer for api.example.com: %v", a.Addresses)
+	}
+
+	// at least ndots dots: the NXDOMAIN of the absolute name is final, the
+	// search domain doesn't answer in its place
+	d, err = newTestResolver(t.TempDir(), port,
+		"nameserver 127.0.0.1", "search svc.cluster.local", "options ndots:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.add("gone.example.com.svc.cluster.local. 30 IN A 10.0.0.99"); err != nil {
+		t.Fatal(err)
+	}
+	a, err = d.Resolve(context.Background(), "gone.example.com", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 0 || a.Outcome != OutcomeNXDomain {
+		t.Errorf("expected a NXDOMAIN for gone.example.com, got %v (%s)", a.Addresses, a.Outcome)
+	}
+}
+
+func TestDNSResolverSearchFailures(t *testing.T) {
+	f, err := startFakeDNSServer("127.0.0.1:0", []string{"api. 30 IN A 192.0.2.20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.stop()
+	_, port, _ := net.SplitHostPort(f.addr)
+	d, err := newTestResolver(t.TempDir(), port,
+		"nameserver 127.0.0.1", "search svc.cluster.local", "options timeout:1 attempts:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next names are tried when one times out
+	f.drop("api.svc.cluster.local", true)
+	a, err := d.Resolve(context.Background(), "api", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 1 || a.Addresses[0].IP.String() != "192.0.2.20" {
+		t.Errorf("unexpected answer for api: %v", a.Addresses)
+	}
+
+	// The NXDOMAIN of the other names isn't authoritative then
+	f.drop("github.com", true)
+	if _, err := d.Resolve(context.Background(), "github.com", dns.TypeA); !isTimeout(err) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestDNSResolverTruncated(t *testing.T) {
+	zone := []string{}
+	for i := 1; i <= 200; i++ {
+		zone = append(zone, fmt.Sprintf("cdn.example.com. 60 IN A 192.0.2.%d", i))
+	}
+	f, err := startFakeDNSServer("127.0.0.1:0", zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.stop()
+	d, err := f.resolver(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := d.Resolve(context.Background(), "cdn.example.com.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Addresses) != 200 {
+		t.Errorf("expected the complete answer to be retrieved over TCP, got %d addresses", len(a.Addresses))
+	}
+}
+
+func TestDNSResolverCNAME(t *testing.T) {
+	zone := []string{
+		"www.example.com. 300 IN CNAME edge.example.net.",
+		"edge.example.net. 20 IN CNAME edge1.example.org.",
+		"edge1.example.org. 60 IN A 192.0.2.1",
+		"loop1.example.com. 60 IN CNAME loop2.example.com.",
+		"loop2.example.com. 60 IN CNAME loop1.example.com.",
+	}
+	for _, flatten := range []bool{false, true} {
+		f, err := startFakeDNSServer("127.0.0.1:0", zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.mu.Lock()
+		f.flatten = flatten
+		f.mu.Unlock()
+		d, err := f.resolver(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := d.Resolve(context.Background(), "www.example.com.", dns.TypeA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a.Addresses) != 1 || a.Addresses[0].IP.String() != "192.0.2.1" {
+			t.Errorf("flatten=%v: unexpected addresses %v", flatten, a.Addresses)
+		}
+		if len(a.CNAMEs) != 2 || a.CNAMEs[1].Target != "edge1.example.org." {
+			t.Errorf("flatten=%v: unexpected CNAME chain %v", flatten, a.CNAMEs)
+		}
+		if ttl := a.MinTTL(30); ttl != 20 {
+			t.Errorf("flatten=%v: expected the lowest TTL of the chain, got %d", flatten, ttl)
+		}
+
+		if _, err := d.Resolve(context.Background(), "loop1.example.com.", dns.TypeA); err == nil {
+			t.Errorf("flatten=%v: a CNAME loop should be an error", flatten)
+		}
+
+		d.MaxCNAMEDepth = 1
+		if _, err := d.Resolve(context.Background(), "www.example.com.", dns.TypeA); err == nil {
+			t.Errorf("flatten=%v: a CNAME chain longer than the maximum depth should be an error", flatten)
+		}
+		f.stop()
+	}
+}
+
+// slowResolver is a Resolver that blocks until its context is done, keeping
+// track of how many queries are in flight
+type slowResolver struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	<-ctx.Done()
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+func TestResolveAll(t *testing.T) {
+	s := &slowResolver{}
+	queries := []query{}
+	for i := 0; i < 20; i++ {
+		queries = append(queries, query{fqdn: fmt.Sprintf("host%d.example.com", i), recordType: dns.TypeA})
+	}
+	// duplicates are only resolved once
+	queries = append(queries, queries[0])
+
+	results := resolveAll(context.Background(), s, queries, 5, 50*time.Millisecond)
+	if len(results) != 20 {
+		t.Errorf("expected 20 results, got %d", len(results))
+	}
+	for q, res := range results {
+		if res.err == nil {
+			t.Errorf("expected %s to time out", q.fqdn)
+		}
+	}
+	if s.maxInFlight != 5 {
+		t.Errorf("expected at most 5 queries in flight, got %d", s.maxInFlight)
+	}
+}
@@ -0,0 +1,330 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+// fqdnScheduler keeps track of the FQDNs used by the FQDNNetworkPolicies and
+// resolves each of them again, once, when its TTL expires. Only the
+// FQDNNetworkPolicies using a FQDN whose addresses changed, or that started
+// or stopped failing to resolve, are sent to the events channel to be
+// reconciled.
+type fqdnScheduler struct {
+	resolver     Resolver
+	log          logr.Logger
+	parallelism  int
+	queryTimeout time.Duration
+	// events receives the FQDNNetworkPolicies to reconcile
+	events chan event.GenericEvent
+
+	mu sync.Mutex
+	// fqdns are the FQDNs tracked, by record type
+	fqdns map[query]*scheduledFQDN
+	// policies are the queries used by each FQDNNetworkPolicy
+	policies map[types.NamespacedName]map[query]bool
+	// unsynced are the FQDNNetworkPolicies whose last reconciliation failed
+	unsynced map[types.NamespacedName]bool
+	// wakeup is used to notify the scheduling loop that the schedule changed
+	wakeup chan struct{}
+	now    func() time.Time
+}
+
+// scheduledFQDN is a FQDN and record type tracked by the fqdnScheduler
+type scheduledFQDN struct {
+	// addresses are the addresses last resolved, sorted
+	addresses []string
+	// failing is whether the FQDN failed to resolve the last time
+	failing bool
+	// next is when the FQDN needs to be resolved again
+	next time.Time
+	// policies are the FQDNNetworkPolicies using the FQDN, with their
+	// intervals between syncs
+	policies map[types.NamespacedName]syncIntervals
+}
+
+// refreshIn returns how long until the FQDN needs to be resolved again
+// after res, the shortest interval of the FQDNNetworkPolicies using it.
+func (f *scheduledFQDN) refreshIn(res result) time.Duration {
+	var d time.Duration
+	for _, intervals := range f.policies {
+		next := intervals.retry
+		if res.err == nil {
+			next = intervals.refreshIn(res.answer)
+		}
+		if d == 0 || next < d {
+			d = next
+		}
+	}
+	return d
+}
+
+// minRefresh is the minimum time between two resolutions of a FQDN by the
+// scheduler, so that records with a TTL of 0 don't make it spin.
+const minRefresh = time.Second
+
+func newFQDNScheduler(resolver Resolver, log logr.Logger, parallelism int, queryTimeout time.Duration) *fqdnScheduler {
+	return &fqdnScheduler{
+		resolver:     resolver,
+		log:          log,
+		parallelism:  parallelism,
+		queryTimeout: queryTimeout,
+		events:       make(chan event.GenericEvent),
+		fqdns:        map[query]*scheduledFQDN{},
+		policies:     map[types.NamespacedName]map[query]bool{},
+		unsynced:     map[types.NamespacedName]bool{},
+		wakeup:       make(chan struct{}, 1),
+		now:          time.Now,
+	}
+}
+
+// track records the answers used by a FQDNNetworkPolicy in its last
+// reconciliation, and when the FQDNs need to be resolved again.
+func (s *fqdnScheduler) track(nn types.NamespacedName, answers map[query]result, intervals syncIntervals) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	delete(s.unsynced, nn)
+	used := map[query]bool{}
+	for q, res := range answers {
+		used[q] = true
+		f, ok := s.fqdns[q]
+		if !ok {
+			f = &scheduledFQDN{policies: map[types.NamespacedName]syncIntervals{}}
+			s.fqdns[q] = f
+		}
+		f.policies[nn] = intervals
+		f.failing = res.err != nil
+		if res.err != nil {
+			if f.next.IsZero() {
+				f.next = now.Add(f.refreshIn(res))
+			}
+			continue
+		}
+		f.addresses = sortedAddresses(res.answer)
+		f.next = now.Add(f.refreshIn(res))
+	}
+	// The FQDNs the FQDNNetworkPolicy doesn't use anymore
+	for q := range s.policies[nn] {
+		if !used[q] {
+			s.untrack(nn, q)
+		}
+	}
+	s.policies[nn] = used
+	s.notify()
+}
+
+// forget stops tracking the FQDNs of a FQDNNetworkPolicy
+func (s *fqdnScheduler) forget(nn types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for q := range s.policies[nn] {
+		s.untrack(nn, q)
+	}
+	delete(s.policies, nn)
+	delete(s.unsynced, nn)
+	s.notify()
+}
+
+// syncFailed records that the last reconciliation of a FQDNNetworkPolicy
+// failed, until its answers are tracked again.
+func (s *fqdnScheduler) syncFailed(nn types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsynced[nn] = true
+}
+
+// untrack removes a FQDNNetworkPolicy from the policies using a query.
+// s.mu must be held.
+func (s *fqdnScheduler) untrack(nn types.NamespacedName, q query) {
+	f, ok := s.fqdns[q]
+	if !ok {
+		return
+	}
+	delete(f.policies, nn)
+	if len(f.policies) == 0 {
+		delete(s.fqdns, q)
+	}
+}
+
+// notify wakes up the scheduling loop. s.mu must be held.
+func (s *fqdnScheduler) notify() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Start implements manager.Runnable. It resolves the FQDNs whose TTL
+// expired until ctx is done.
+func (s *fqdnScheduler) Start(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.wakeup:
+		case <-timer.C:
+			s.refresh(ctx)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, ok := s.nextRefresh(); ok {
+			timer.Reset(next.Sub(s.now()))
+		}
+	}
+}
+
+// nextRefresh returns when the next FQDN needs to be resolved
+func (s *fqdnScheduler) nextRefresh() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, f := range s.fqdns {
+		if next.IsZero() || f.next.Before(next) {
+			next = f.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// refresh resolves the FQDNs whose TTL expired, and sends the
+// FQDNNetworkPolicies using the ones whose addresses changed, or that
+// started or stopped failing to resolve, to the events channel.
+func (s *fqdnScheduler) refresh(ctx context.Context) {
+	s.mu.Lock()
+	now := s.now()
+	due := []query{}
+	for q, f := range s.fqdns {
+		if !f.next.After(now) {
+			due = append(due, q)
+		}
+	}
+	s.mu.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	answers := resolveAll(ctx, s.resolver, due, s.parallelism, s.queryTimeout)
+
+	s.mu.Lock()
+	now = s.now()
+	changed := map[types.NamespacedName]bool{}
+	refreshed := map[types.NamespacedName]bool{}
+	for q, res := range answers {
+		f, ok := s.fqdns[q]
+		if !ok {
+			// not used anymore
+			continue
+		}
+		if res.err != nil {
+			// Not touching the addresses on transient failures, only an
+			// authoritative answer can remove them
+			s.log.Error(res.err, "unable to resolve "+q.fqdn, "outcome", classify(nil, res.err))
+			f.next = now.Add(f.refreshIn(res))
+			if !f.failing {
+				// The FQDNNetworkPolicies handle the failure according to
+				// their failure policy, and report it
+				f.failing = true
+				for nn := range f.policies {
+					changed[nn] = true
+				}
+			}
+			continue
+		}
+		f.next = now.Add(f.refreshIn(res))
+		if f.failing {
+			// The FQDNNetworkPolicies report that it resolves again
+			f.failing = false
+			for nn := range f.policies {
+				changed[nn] = true
+			}
+		}
+		addresses := sortedAddresses(res.answer)
+		if !equalStrings(addresses, f.addresses) {
+			s.log.V(1).Info("addresses changed for "+q.fqdn, "addresses", addresses)
+			f.addresses = addresses
+			for nn := range f.policies {
+				changed[nn] = true
+			}
+		}
+		for nn := range f.policies {
+			refreshed[nn] = true
+		}
+	}
+	// The NetworkPolicies of the FQDNNetworkPolicies that are reconciled
+	// are synced then. The other ones are still up to date if all their
+	// FQDNs resolve, to the same addresses.
+	for nn := range refreshed {
+		if changed[nn] || s.unsynced[nn] || s.failing(nn) {
+			continue
+		}
+		policyLastSync.WithLabelValues(nn.Namespace, nn.Name).Set(float64(now.Unix()))
+	}
+	s.mu.Unlock()
+
+	for nn := range changed {
+		select {
+		case s.events <- event.GenericEvent{Object: &networkingv1alpha3.FQDNNetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: nn.Namespace, Name: nn.Name},
+		}}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// failing returns whether some FQDNs of a FQDNNetworkPolicy failed to
+// resolve the last time. s.mu must be held.
+func (s *fqdnScheduler) failing(nn types.NamespacedName) bool {
+	for q := range s.policies[nn] {
+		if f, ok := s.fqdns[q]; ok && f.failing {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedAddresses returns the addresses of the answer as sorted strings
+func sortedAddresses(answer *Answer) []string {
+	addresses := []string{}
+	for _, address := range answer.Addresses {
+		addresses = append(addresses, address.IP.String())
+	}
+	sort.Strings(addresses)
+	return addresses
+}
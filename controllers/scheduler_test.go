@@ -0,0 +1,310 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// mapResolver is a Resolver answering with the addresses, or the error, set
+// for each FQDN, counting the queries it receives
+type mapResolver struct {
+	mu        sync.Mutex
+	addresses map[string][]string
+	errs      map[string]error
+	queries   map[string]int
+}
+
+func (m *mapResolver) Resolve(ctx context.Context, fqdn string, recordType uint16) (*Answer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries[fqdn]++
+	if err := m.errs[fqdn]; err != nil {
+		return nil, err
+	}
+	answer := &Answer{Addresses: []Address{}}
+	for _, ip := range m.addresses[fqdn] {
+		answer.Addresses = append(answer.Addresses, Address{IP: net.ParseIP(ip), TTL: 10})
+	}
+	return answer, nil
+}
+
+func (m *mapResolver) set(fqdn string, addresses ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addresses[fqdn] = addresses
+}
+
+func (m *mapResolver) fail(fqdn string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.errs == nil {
+		m.errs = map[string]error{}
+	}
+	m.errs[fqdn] = err
+}
+
+func TestFQDNScheduler(t *testing.T) {
+	resolver := &mapResolver{
+		addresses: map[string][]string{
+			"github.com": {"192.0.2.1"},
+			"gitlab.com": {"192.0.2.2"},
+		},
+		queries: map[string]int{},
+	}
+	s := newFQDNScheduler(resolver, logr.Discard(), 10, time.Second)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	// Buffered so that refresh doesn't block without a controller reading
+	s.events = make(chan event.GenericEvent, 10)
+
+	ctx := context.Background()
+	intervals := syncIntervals{minTTL: time.Second, maxTTL: 30 * time.Second, retry: 10 * time.Second}
+	track := func(nn types.NamespacedName, fqdns ...string) {
+		queries := []query{}
+		for _, fqdn := range fqdns {
+			queries = append(queries, query{fqdn: fqdn, recordType: dns.TypeA})
+		}
+		s.track(nn, resolveAll(ctx, resolver, queries, 10, time.Second), intervals)
+	}
+	a := types.NamespacedName{Namespace: "default", Name: "a"}
+	b := types.NamespacedName{Namespace: "default", Name: "b"}
+	track(a, "github.com")
+	track(b, "github.com", "gitlab.com")
+	resolver.queries = map[string]int{}
+
+	// Nothing is due before the TTL expires
+	s.refresh(ctx)
+	if len(resolver.queries) != 0 {
+		t.Errorf("expected no queries before the TTL expires, got %v", resolver.queries)
+	}
+
+	// Only the policy using the FQDN that changed is enqueued,
+	// and each FQDN is resolved once
+	resolver.set("gitlab.com", "192.0.2.3")
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if resolver.queries["github.com"] != 1 || resolver.queries["gitlab.com"] != 1 {
+		t.Errorf("expected each FQDN to be resolved once, got %v", resolver.queries)
+	}
+	if len(s.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(s.events))
+	}
+	if e := <-s.events; e.Object.GetName() != "b" {
+		t.Errorf("expected b to be enqueued, got %s", e.Object.GetName())
+	}
+
+	// Nothing is enqueued when the addresses didn't change
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if len(s.events) != 0 {
+		t.Errorf("expected no event, got %d", len(s.events))
+	}
+
+	// A forgotten policy isn't enqueued anymore, and FQDNs nobody uses
+	// aren't resolved anymore
+	s.forget(b)
+	resolver.set("github.com", "192.0.2.4")
+	resolver.queries = map[string]int{}
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if resolver.queries["gitlab.com"] != 0 {
+		t.Errorf("expected gitlab.com not to be resolved anymore")
+	}
+	if len(s.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(s.events))
+	}
+	if e := <-s.events; e.Object.GetName() != "a" {
+		t.Errorf("expected a to be enqueued, got %s", e.Object.GetName())
+	}
+
+	// A policy is enqueued when its FQDN starts failing to resolve, to apply
+	// its failure policy, but not again while it keeps failing
+	resolver.fail("github.com", context.DeadlineExceeded)
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if len(s.events) != 1 {
+		t.Fatalf("expected 1 event when starting to fail, got %d", len(s.events))
+	}
+	if e := <-s.events; e.Object.GetName() != "a" {
+		t.Errorf("expected a to be enqueued, got %s", e.Object.GetName())
+	}
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if len(s.events) != 0 {
+		t.Errorf("expected no event while still failing, got %d", len(s.events))
+	}
+
+	// And again when it resolves again, even to the same addresses
+	resolver.fail("github.com", nil)
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if len(s.events) != 1 {
+		t.Fatalf("expected 1 event when resolving again, got %d", len(s.events))
+	}
+	if e := <-s.events; e.Object.GetName() != "a" {
+		t.Errorf("expected a to be enqueued, got %s", e.Object.GetName())
+	}
+}
+
+func TestFQDNSchedulerLastSync(t *testing.T) {
+	resolver := &mapResolver{
+		addresses: map[string][]string{"github.com": {"192.0.2.1"}, "gitlab.com": {"192.0.2.2"}},
+		queries:   map[string]int{},
+	}
+	s := newFQDNScheduler(resolver, logr.Discard(), 10, time.Second)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.events = make(chan event.GenericEvent, 10)
+
+	ctx := context.Background()
+	nn := types.NamespacedName{Namespace: "default", Name: "lastsync"}
+	gauge := policyLastSync.WithLabelValues(nn.Namespace, nn.Name)
+	gauge.Set(42)
+	defer deletePolicyMetrics(nn)
+	queries := []query{{fqdn: "github.com", recordType: dns.TypeA}, {fqdn: "gitlab.com", recordType: dns.TypeA}}
+	s.track(nn, resolveAll(ctx, resolver, queries, 10, time.Second),
+		syncIntervals{minTTL: time.Second, maxTTL: 30 * time.Second, retry: 10 * time.Second})
+
+	// The NetworkPolicy is still up to date when all the FQDNs resolve to
+	// the same addresses
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if v := testutil.ToFloat64(gauge); v != float64(now.Unix()) {
+		t.Errorf("expected the last sync time to be %d, got %v", now.Unix(), v)
+	}
+
+	// But not when one of them fails to resolve
+	resolver.fail("gitlab.com", context.DeadlineExceeded)
+	gauge.Set(42)
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	<-s.events
+	if v := testutil.ToFloat64(gauge); v != 42 {
+		t.Errorf("expected the last sync time not to move while failing, got %v", v)
+	}
+
+	// Nor when the last Reconcile of the FQDNNetworkPolicy failed,
+	// refreshing its FQDNs doesn't make it successful
+	resolver.fail("gitlab.com", nil)
+	s.syncFailed(nn)
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	<-s.events
+	now = now.Add(10 * time.Second)
+	s.refresh(ctx)
+	if v := testutil.ToFloat64(gauge); v != 42 {
+		t.Errorf("expected the last sync time not to move after a failed sync, got %v", v)
+	}
+}
+
+func TestSyncIntervals(t *testing.T) {
+	r := &FQDNNetworkPolicyReconciler{MinTTL: 5 * time.Second, MaxTTL: 30 * time.Second, RetryInterval: 10 * time.Second}
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+
+	intervals, err := r.syncIntervals(&fqdnNetworkPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ttl, expected := range map[uint32]time.Duration{
+		0:    5 * time.Second,
+		10:   10 * time.Second,
+		3600: 30 * time.Second,
+	} {
+		answer := &Answer{Addresses: []Address{{IP: net.ParseIP("192.0.2.1"), TTL: ttl}}}
+		if d := intervals.refreshIn(answer); d != expected {
+			t.Errorf("expected %s for a TTL of %d, got %s", expected, ttl, d)
+		}
+	}
+
+	fqdnNetworkPolicy.Annotations = map[string]string{
+		minTTLAnnotation: "1m",
+		maxTTLAnnotation: "1h",
+		retryAnnotation:  "2s",
+	}
+	intervals, err = r.syncIntervals(&fqdnNetworkPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := syncIntervals{minTTL: time.Minute, maxTTL: time.Hour, retry: 2 * time.Second}
+	if intervals != expected {
+		t.Errorf("expected %+v, got %+v", expected, intervals)
+	}
+
+	// Keeping the last known addresses up to the maximum staleness
+	r.MaxStaleness = time.Hour
+	fqdnNetworkPolicy.Annotations = map[string]string{failurePolicyAnnotation: KeepLastKnownGood}
+	if intervals, err = r.syncIntervals(&fqdnNetworkPolicy); err != nil || intervals.maxStaleness != time.Hour {
+		t.Errorf("unexpected maximum staleness %s (%v)", intervals.maxStaleness, err)
+	}
+	fqdnNetworkPolicy.Annotations[maxStalenessAnnotation] = "10m"
+	if intervals, err = r.syncIntervals(&fqdnNetworkPolicy); err != nil || intervals.maxStaleness != 10*time.Minute {
+		t.Errorf("unexpected maximum staleness %s (%v)", intervals.maxStaleness, err)
+	}
+
+	for _, annotations := range []map[string]string{
+		{failurePolicyAnnotation: "fail-open"},
+		{failurePolicyAnnotation: KeepLastKnownGood, maxStalenessAnnotation: "0s"},
+		{minTTLAnnotation: "soon"},
+		{retryAnnotation: "-1s"},
+		{minTTLAnnotation: "1m", maxTTLAnnotation: "30s"},
+	} {
+		fqdnNetworkPolicy.Annotations = annotations
+		if intervals, err := r.syncIntervals(&fqdnNetworkPolicy); err == nil {
+			t.Errorf("expected an error for %v", annotations)
+		} else if intervals.retry != r.RetryInterval {
+			t.Errorf("expected the default retry interval for %v, got %s", annotations, intervals.retry)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, expected := range map[int32]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+	} {
+		d := backoff(10*time.Second, time.Minute, attempts)
+		// up to 10% of jitter
+		if d < expected || d > expected+expected/10 {
+			t.Errorf("expected about %s after %d attempts, got %s", expected, attempts, d)
+		}
+	}
+	// The jitter never goes past the maximum
+	for i := 0; i < 100; i++ {
+		if d := backoff(10*time.Second, time.Minute, 10); d != time.Minute {
+			t.Fatalf("expected a minute after 10 attempts, got %s", d)
+		}
+		if d := backoff(10*time.Second, 15*time.Second, 2); d > 15*time.Second {
+			t.Fatalf("expected at most 15s after 2 attempts, got %s", d)
+		}
+	}
+	// The retry interval is used if it's higher than the maximum
+	if d := backoff(time.Hour, time.Minute, 1); d != time.Hour {
+		t.Errorf("expected an hour, got %s", d)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package controllers
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -43,6 +44,8 @@ import (
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var fakeDNS *fakeDNSServer
+var fakeDNSDir string
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -79,10 +82,28 @@ var _ = BeforeSuite(func(done Done) {
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	By("starting the fake DNS server")
+	fakeDNS, err = startFakeDNSServer("127.0.0.1:0", fakeZone)
+	Expect(err).ToNot(HaveOccurred())
+	fakeDNSDir, err = os.MkdirTemp("", "fqdnnetworkpolicies")
+	Expect(err).ToNot(HaveOccurred())
+	resolver, err := fakeDNS.resolver(fakeDNSDir)
+	Expect(err).ToNot(HaveOccurred())
+
 	err = (&FQDNNetworkPolicyReconciler{
+		Client:   k8sManager.GetClient(),
+		Scheme:   k8sManager.GetScheme(),
+		Log:      ctrl.Log.WithName("controllers").WithName("FQDNNetworkPolicy"),
+		Resolver: resolver,
+		// failing fast on the queries dropped by the fake DNS server
+		QueryTimeout: time.Second,
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&ClusterFQDNNetworkPolicyReconciler{
 		Client: k8sManager.GetClient(),
 		Scheme: k8sManager.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("FQDNNetworkPolicy"),
+		Log:    ctrl.Log.WithName("controllers").WithName("ClusterFQDNNetworkPolicy"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -103,6 +124,10 @@ var _ = BeforeSuite(func(done Done) {
 }, 60)
 
 var _ = AfterSuite(func() {
+	if fakeDNS != nil {
+		fakeDNS.stop()
+	}
+	os.RemoveAll(fakeDNSDir)
 	//	By("tearing down the test environment")
 	//	err := testEnv.Stop()
 	//	Expect(err).NotTo(HaveOccurred())
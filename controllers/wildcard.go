@@ -0,0 +1,197 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+// HostnameSource provides the hostnames matching the wildcard FQDNs of the
+// FQDNNetworkPolicies, as wildcards can't be resolved.
+type HostnameSource interface {
+	// Hostnames returns the hostnames known to match pattern, a FQDN whose
+	// leftmost label is *
+	Hostnames(pattern string) []string
+}
+
+// maxWildcardHostnames bounds the number of hostnames a wildcard FQDN is
+// expanded into, as each of them is resolved
+const maxWildcardHostnames = 100
+
+// isWildcard returns whether fqdn is a wildcard FQDN, such as *.example.com
+func isWildcard(fqdn string) bool {
+	return strings.HasPrefix(fqdn, "*.")
+}
+
+// matchWildcard returns whether hostname matches pattern. The * of the
+// pattern matches a single label: *.example.com matches api.example.com,
+// but neither example.com nor a.b.example.com.
+func matchWildcard(pattern string, hostname string) bool {
+	suffix := strings.ToLower(strings.TrimSuffix(pattern[1:], "."))
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	label := strings.TrimSuffix(hostname, suffix)
+	return len(label) < len(hostname) && label != "" && !strings.Contains(label, ".")
+}
+
+// wildcardHostnamesChangedPredicate triggers a reconciliation when the
+// wildcard hostnames listed in the status of a FQDNNetworkPolicy change
+func wildcardHostnamesChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old, ok := e.ObjectOld.(*networkingv1alpha3.FQDNNetworkPolicy)
+			if !ok {
+				return false
+			}
+			updated, ok := e.ObjectNew.(*networkingv1alpha3.FQDNNetworkPolicy)
+			if !ok {
+				return false
+			}
+			return !equalStrings(old.Status.WildcardHostnames, updated.Status.WildcardHostnames)
+		},
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// QueryLog is a HostnameSource providing the names recently queried, as
+// read from a DNS query log, such as the one written by the log plugin of
+// CoreDNS. It's a Runnable following the log file.
+type QueryLog struct {
+	// Path is the path of the query log file, or of a named pipe
+	Path string
+	// Retention is how long a name is remembered after it was last queried.
+	// Defaults to 1 hour.
+	Retention time.Duration
+
+	mu    sync.Mutex
+	names map[string]time.Time
+	// lastPurge is when the names not queried anymore were last removed
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+var _ HostnameSource = &QueryLog{}
+
+// pollInterval is how often the query log is read again once its end is reached
+const pollInterval = time.Second
+
+// NewQueryLog returns a QueryLog following the query log at path
+func NewQueryLog(path string, retention time.Duration) *QueryLog {
+	if retention <= 0 {
+		retention = time.Hour
+	}
+	return &QueryLog{Path: path, Retention: retention, names: map[string]time.Time{}, now: time.Now}
+}
+
+// Start reads the query log until ctx is done, waiting for new lines when its
+// end is reached
+func (q *QueryLog) Start(ctx context.Context) error {
+	f, err := os.Open(q.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	partial := ""
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err == nil {
+			q.Observe(parseQueryLogLine(partial))
+			partial = ""
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Observe records that name was just queried
+func (q *QueryLog) Observe(name string) {
+	if name == "" {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	q.names[strings.ToLower(strings.TrimSuffix(name, "."))] = now
+	// Forgetting the names not queried anymore, at most once per purgeInterval
+	if now.Sub(q.lastPurge) >= purgeInterval {
+		for n, t := range q.names {
+			if now.Sub(t) > q.Retention {
+				delete(q.names, n)
+			}
+		}
+		q.lastPurge = now
+	}
+}
+
+// Hostnames implements HostnameSource
+func (q *QueryLog) Hostnames(pattern string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	hostnames := []string{}
+	for n, t := range q.names {
+		if now.Sub(t) <= q.Retention && matchWildcard(pattern, n) {
+			hostnames = append(hostnames, n)
+		}
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// parseQueryLogLine returns the name queried in a line of a query log, either
+// in the format of the log plugin of CoreDNS, where the question is quoted:
+//
+//	[INFO] 10.0.0.1:53517 - 44911 "A IN api.example.com. udp 33 false 512" NOERROR qr,rd 106 0.0001s
+//
+// or a line holding only the name. It returns an empty string if there is none.
+func parseQueryLogLine(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, `"`); i >= 0 {
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 3 {
+			return ""
+		}
+		return fields[2]
+	}
+	if line == "" || strings.ContainsAny(line, " \t") {
+		return ""
+	}
+	return line
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	for hostname, expected := range map[string]bool{
+		"api.example.com":      true,
+		"API.Example.com.":     true,
+		"example.com":          false,
+		".example.com":         false,
+		"a.b.example.com":      false,
+		"api.notexample.com":   false,
+		"api.example.com.evil": false,
+	} {
+		if matchWildcard("*.example.com", hostname) != expected {
+			t.Errorf("expected matching %s to be %t", hostname, expected)
+		}
+	}
+}
+
+func TestParseQueryLogLine(t *testing.T) {
+	for line, expected := range map[string]string{
+		`[INFO] 10.0.0.1:53517 - 44911 "A IN api.example.com. udp 33 false 512" NOERROR qr,rd 106 0.0001s`: "api.example.com.",
+		"www.example.com\n":                           "www.example.com",
+		"[INFO] plugin/reload: Running configuration": "",
+		"": "",
+	} {
+		if name := parseQueryLogLine(line); name != expected {
+			t.Errorf("expected %q for %q, got %q", expected, line, name)
+		}
+	}
+}
+
+func TestQueryLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	if err := os.WriteFile(path, []byte(
+		`[INFO] 10.0.0.1:53517 - 44911 "A IN api.example.com. udp 33 false 512" NOERROR qr,rd 106 0.0001s`+"\n"+
+			"github.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := NewQueryLog(path, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Start(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(q.Hostnames("*.example.com")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the lines appended later are read too
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("www.example.com\n")
+	f.Close()
+	for len(q.Hostnames("*.example.com")) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if hostnames := q.Hostnames("*.example.com"); !equalStrings(hostnames, []string{"api.example.com", "www.example.com"}) {
+		t.Errorf("unexpected hostnames %v", hostnames)
+	}
+
+	// the names not queried anymore are forgotten
+	now := time.Now().Add(2 * time.Hour)
+	q.mu.Lock()
+	q.now = func() time.Time { return now }
+	q.mu.Unlock()
+	if hostnames := q.Hostnames("*.example.com"); len(hostnames) != 0 {
+		t.Errorf("expected the hostnames to be forgotten, got %v", hostnames)
+	}
+}
+
+// staticHostnames is a HostnameSource providing a fixed list of hostnames
+type staticHostnames []string
+
+func (s staticHostnames) Hostnames(pattern string) []string {
+	hostnames := []string{}
+	for _, h := range s {
+		if matchWildcard(pattern, h) {
+			hostnames = append(hostnames, h)
+		}
+	}
+	return hostnames
+}
+
+func TestWildcardHostnames(t *testing.T) {
+	r := &FQDNNetworkPolicyReconciler{Hostnames: staticHostnames{"www.example.com", "github.com"}}
+	fqdnNetworkPolicy := getFQDNNetworkPolicy("test", "default")
+	fqdnNetworkPolicy.Status.WildcardHostnames = []string{"api.example.com", "www.example.com.", "a.b.example.com"}
+	hostnames := r.wildcardHostnames(&fqdnNetworkPolicy, "*.example.com")
+	if !equalStrings(hostnames, []string{"api.example.com", "www.example.com"}) {
+		t.Errorf("unexpected hostnames %v", hostnames)
+	}
+}
+
+func TestWildcardHostnamesChangedPredicate(t *testing.T) {
+	p := wildcardHostnamesChangedPredicate()
+	old := getFQDNNetworkPolicy("test", "default")
+	updated := old.DeepCopy()
+	updated.Status.State = networkingv1alpha3.ActiveState
+	if p.Update(event.UpdateEvent{ObjectOld: &old, ObjectNew: updated}) {
+		t.Errorf("expected the other status updates to be ignored")
+	}
+	updated.Status.WildcardHostnames = []string{"api.example.com"}
+	if !p.Update(event.UpdateEvent{ObjectOld: &old, ObjectNew: updated}) {
+		t.Errorf("expected the wildcard hostnames update to trigger a reconciliation")
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	failed := result{err: errors.New("i/o timeout")}
+	api := result{answer: &Answer{Addresses: []Address{{IP: net.ParseIP("192.0.2.1"), TTL: 30}}}}
+	www := result{answer: &Answer{Addresses: []Address{{IP: net.ParseIP("192.0.2.2"), TTL: 60}}}}
+
+	merged := mergeResults([]result{api, failed, www})
+	if merged.err != nil || !equalStrings(sortedAddresses(merged.answer), []string{"192.0.2.1", "192.0.2.2"}) ||
+		merged.answer.Outcome != OutcomeSuccess {
+		t.Errorf("unexpected result %+v", merged)
+	}
+	if merged := mergeResults([]result{failed, failed}); merged.err == nil {
+		t.Error("expected an error when all the hostnames failed")
+	}
+	if merged := mergeResults(nil); merged.err != nil || merged.answer.Outcome != OutcomeNoData {
+		t.Errorf("unexpected result without hostnames %+v", merged)
+	}
+}
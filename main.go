@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -32,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	networkingv1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	networkingv1beta1 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1beta1"
 	"github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,6 +47,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(networkingv1alpha3.AddToScheme(scheme))
+	utilruntime.Must(networkingv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,11 +55,61 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var maxCNAMEDepth int
+	var maxConcurrentReconciles int
+	var maxConcurrentQueries int
+	var queryTimeout time.Duration
+	var disableDNSCache bool
+	var minTTL time.Duration
+	var maxTTL time.Duration
+	var retryInterval time.Duration
+	var maxRetryInterval time.Duration
+	var ipRetention time.Duration
+	var failurePolicy string
+	var maxStaleness time.Duration
+	var maxPrefixWidening int
+	var queryLog string
+	var queryLogRetention time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxCNAMEDepth, "max-cname-depth", 8,
+		"The maximum number of CNAME records followed when resolving a FQDN.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The maximum number of FQDNNetworkPolicies reconciled at the same time.")
+	flag.IntVar(&maxConcurrentQueries, "max-concurrent-queries", 10,
+		"The maximum number of DNS queries in flight for a single FQDNNetworkPolicy.")
+	flag.DurationVar(&queryTimeout, "query-timeout", 0,
+		"How long to wait for a FQDN to be resolved, across all nameservers, attempts and names of the search list. "+
+			"0 leaves it to the options of resolv.conf: up to timeout × attempts × nameservers for each name tried.")
+	flag.BoolVar(&disableDNSCache, "disable-dns-cache", false,
+		"Disable the DNS cache shared by all FQDNNetworkPolicies, querying the nameservers on every sync.")
+	flag.DurationVar(&minTTL, "min-ttl", 5*time.Second,
+		"The lowest time between two resolutions of a FQDN, even if the TTL of its records is lower.")
+	flag.DurationVar(&maxTTL, "max-ttl", 30*time.Second,
+		"The highest time between two resolutions of a FQDN, even if the TTL of its records is higher.")
+	flag.DurationVar(&retryInterval, "retry-interval", 10*time.Second,
+		"How long to wait before reconciling a FQDNNetworkPolicy again after an error, doubled on each consecutive error.")
+	flag.DurationVar(&maxRetryInterval, "max-retry-interval", 5*time.Minute,
+		"The highest time to wait before reconciling a FQDNNetworkPolicy again after consecutive errors.")
+	flag.DurationVar(&ipRetention, "ip-retention", 0,
+		"How long the addresses of a FQDN are kept in the NetworkPolicy after they stopped being resolved.")
+	flag.StringVar(&failurePolicy, "failure-policy", controllers.FailClosed,
+		"What happens to the addresses of a FQDN that fails to resolve: "+controllers.FailClosed+" removes them from the "+
+			"NetworkPolicy, "+controllers.KeepLastKnownGood+" keeps them up to --max-staleness.")
+	flag.DurationVar(&maxStaleness, "max-staleness", time.Hour,
+		"How long the last known addresses of a FQDN that fails to resolve are kept, with the "+
+			controllers.KeepLastKnownGood+" failure policy.")
+	flag.IntVar(&maxPrefixWidening, "max-prefix-widening", 0,
+		"How many bits shorter than a single address the CIDRs of the NetworkPolicies can be when merging adjacent "+
+			"addresses, 0 to only remove the duplicate addresses.")
+	flag.StringVar(&queryLog, "query-log", "",
+		"The path of a DNS query log, such as the one of the log plugin of CoreDNS, to expand the wildcard FQDNs "+
+			"into the hostnames queried.")
+	flag.DurationVar(&queryLogRetention, "query-log-retention", time.Hour,
+		"How long a hostname read from the DNS query log matches the wildcard FQDNs after it was last queried.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -89,18 +142,72 @@ func main() {
 		os.Exit(1)
 	}
 
+	var resolver controllers.Resolver = &controllers.DNSResolver{
+		MaxCNAMEDepth: maxCNAMEDepth,
+	}
+	if !disableDNSCache {
+		resolver = controllers.NewCachingResolver(resolver)
+	}
+	var hostnames controllers.HostnameSource
+	if queryLog != "" {
+		q := controllers.NewQueryLog(queryLog, queryLogRetention)
+		if err := mgr.Add(q); err != nil {
+			setupLog.Error(err, "unable to read the DNS query log")
+			os.Exit(1)
+		}
+		hostnames = q
+	}
 	if err = (&controllers.FQDNNetworkPolicyReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("FQDNNetworkPolicy"),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("FQDNNetworkPolicy"),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("fqdnnetworkpolicy-controller"),
+		Resolver:                resolver,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		MaxConcurrentQueries:    maxConcurrentQueries,
+		QueryTimeout:            queryTimeout,
+		MinTTL:                  minTTL,
+		MaxTTL:                  maxTTL,
+		RetryInterval:           retryInterval,
+		MaxRetryInterval:        maxRetryInterval,
+		IPRetention:             ipRetention,
+		FailurePolicy:           failurePolicy,
+		MaxStaleness:            maxStaleness,
+		MaxPrefixWidening:       maxPrefixWidening,
+		Hostnames:               hostnames,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "FQDNNetworkPolicy")
 		os.Exit(1)
 	}
+	if err = (&controllers.ClusterFQDNNetworkPolicyReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("ClusterFQDNNetworkPolicy"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("clusterfqdnnetworkpolicy-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterFQDNNetworkPolicy")
+		os.Exit(1)
+	}
 	if err = (&networkingv1alpha3.FQDNNetworkPolicy{}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "FQDNNetworkPolicy")
 		os.Exit(1)
 	}
+	if err = (&networkingv1beta1.FQDNNetworkPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "FQDNNetworkPolicy")
+		os.Exit(1)
+	}
+	if err = (&networkingv1alpha3.ClusterFQDNNetworkPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterFQDNNetworkPolicy")
+		os.Exit(1)
+	}
+	if err = (&networkingv1alpha3.FQDNSet{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "FQDNSet")
+		os.Exit(1)
+	}
+	if err = (&networkingv1alpha3.ClusterFQDNSet{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterFQDNSet")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {